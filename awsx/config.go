@@ -1,6 +1,7 @@
 package awsx
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -21,7 +22,17 @@ import (
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
-func providerConfigure(d *schema.ResourceData) (interface{}, error) {
+type AWSClient struct {
+	elasticacheconn *elasticache.ElastiCache
+
+	// Done once Terraform asks the provider to stop, e.g. on Ctrl-C
+	stopCtx context.Context
+
+	// nil unless describe_cache is enabled
+	describeCache *describeCache
+}
+
+func providerConfigure(d *schema.ResourceData, stopCtx context.Context) (interface{}, error) {
 	c := terr_aws.Config{
 		AccessKey:     d.Get("access_key").(string),
 		SecretKey:     d.Get("secret_key").(string),
@@ -90,7 +101,12 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 		return nil, &multierror.Error{Errors: errs}
 	}
 
-	return elasticacheconn, nil
+	client := &AWSClient{elasticacheconn: elasticacheconn, stopCtx: stopCtx}
+	if d.Get("describe_cache").(bool) {
+		client.describeCache = newDescribeCache()
+	}
+
+	return client, nil
 }
 
 // This function is responsible for reading credentials from the
@@ -0,0 +1,146 @@
+package awsx
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+// describeCache serves Reads of many replication groups from a single
+// paginated sweep over all groups and cache clusters of the region,
+// instead of a few Describe calls per group.
+//
+// Groups that have been mutated since the sweep are invalidated and
+// always described directly from then on, so a Read following a change
+// never sees the state from before it. A nil *describeCache is valid
+// and describes everything directly.
+type describeCache struct {
+	mu          sync.Mutex
+	swept       bool
+	groups      map[string]*elasticache.ReplicationGroup
+	clusters    map[string]*elasticache.CacheCluster
+	invalidated map[string]bool
+}
+
+func newDescribeCache() *describeCache {
+	return &describeCache{invalidated: make(map[string]bool)}
+}
+
+// replicationGroup returns nil if the group doesn't exist.
+func (c *describeCache) replicationGroup(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string) (*elasticache.ReplicationGroup, error) {
+	if !c.cached(replGroupID) {
+		return describeReplicationGroup(ctx, conn, replGroupID)
+	}
+
+	c.mu.Lock()
+	if err := c.sweep(ctx, conn); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	rg, ok := c.groups[replGroupID]
+	c.mu.Unlock()
+
+	// Not necessarily gone, it may have been created after the sweep
+	if !ok {
+		return describeReplicationGroup(ctx, conn, replGroupID)
+	}
+	return rg, nil
+}
+
+// memberClusters works like describeMemberClusters for
+// the members of the given replication group.
+func (c *describeCache) memberClusters(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string, ids []string) (map[string]*elasticache.CacheCluster, error) {
+	if !c.cached(replGroupID) {
+		return describeMemberClusters(ctx, conn, ids, memberClusterDescribeConcurrency)
+	}
+
+	c.mu.Lock()
+	if err := c.sweep(ctx, conn); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	clusters := make(map[string]*elasticache.CacheCluster, len(ids))
+	var missing []string
+	for _, id := range ids {
+		if cluster, ok := c.clusters[id]; ok {
+			clusters[id] = cluster
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	c.mu.Unlock()
+
+	// Members the sweep hasn't seen are described directly
+	if len(missing) > 0 {
+		rest, err := describeMemberClusters(ctx, conn, missing, memberClusterDescribeConcurrency)
+		if err != nil {
+			return nil, err
+		}
+		for id, cluster := range rest {
+			clusters[id] = cluster
+		}
+	}
+	return clusters, nil
+}
+
+// invalidate has to be called before a replication group is mutated.
+func (c *describeCache) invalidate(replGroupID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidated[replGroupID] = true
+}
+
+func (c *describeCache) cached(replGroupID string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.invalidated[replGroupID]
+}
+
+// sweep describes all replication groups and cache clusters once.
+// It must be called with c.mu held.
+func (c *describeCache) sweep(ctx context.Context, conn *elasticache.ElastiCache) error {
+	if c.swept {
+		return nil
+	}
+
+	log.Printf("[DEBUG] Describing all ElastiCache replication groups and cache clusters")
+	groups := make(map[string]*elasticache.ReplicationGroup)
+	err := conn.DescribeReplicationGroupsPagesWithContext(ctx, &elasticache.DescribeReplicationGroupsInput{
+		MaxRecords: aws.Int64(100),
+	}, func(page *elasticache.DescribeReplicationGroupsOutput, lastPage bool) bool {
+		for _, rg := range page.ReplicationGroups {
+			groups[*rg.ReplicationGroupId] = rg
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	clusters := make(map[string]*elasticache.CacheCluster)
+	err = conn.DescribeCacheClustersPagesWithContext(ctx, &elasticache.DescribeCacheClustersInput{
+		MaxRecords:        aws.Int64(100),
+		ShowCacheNodeInfo: aws.Bool(true),
+	}, func(page *elasticache.DescribeCacheClustersOutput, lastPage bool) bool {
+		for _, cluster := range page.CacheClusters {
+			clusters[*cluster.CacheClusterId] = cluster
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Cached %d replication groups and %d cache clusters", len(groups), len(clusters))
+	c.groups, c.clusters, c.swept = groups, clusters, true
+	return nil
+}
@@ -0,0 +1,114 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestDescribeCache(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+
+		mu.Lock()
+		requests = append(requests, fmt.Sprintf("%s %s%s%s", params.Get("Action"),
+			params.Get("ReplicationGroupId"), params.Get("CacheClusterId"), params.Get("Marker")))
+		mu.Unlock()
+
+		group := func(id string) string {
+			return fmt.Sprintf(`<ReplicationGroup><ReplicationGroupId>%s</ReplicationGroupId><Status>available</Status></ReplicationGroup>`, id)
+		}
+		switch params.Get("Action") {
+		case "DescribeReplicationGroups":
+			switch {
+			case params.Get("ReplicationGroupId") != "":
+				fmt.Fprintf(w, `<DescribeReplicationGroupsResponse><DescribeReplicationGroupsResult>
+  <ReplicationGroups>%s</ReplicationGroups>
+</DescribeReplicationGroupsResult></DescribeReplicationGroupsResponse>`, group(params.Get("ReplicationGroupId")))
+			case params.Get("Marker") == "":
+				fmt.Fprintf(w, `<DescribeReplicationGroupsResponse><DescribeReplicationGroupsResult>
+  <Marker>page-2</Marker><ReplicationGroups>%s</ReplicationGroups>
+</DescribeReplicationGroupsResult></DescribeReplicationGroupsResponse>`, group("tf-test-a"))
+			default:
+				fmt.Fprintf(w, `<DescribeReplicationGroupsResponse><DescribeReplicationGroupsResult>
+  <ReplicationGroups>%s</ReplicationGroups>
+</DescribeReplicationGroupsResult></DescribeReplicationGroupsResponse>`, group("tf-test-b"))
+			}
+		case "DescribeCacheClusters":
+			id := params.Get("CacheClusterId")
+			if id == "" {
+				id = "tf-test-a-001"
+			}
+			fmt.Fprintf(w, `<DescribeCacheClustersResponse><DescribeCacheClustersResult><CacheClusters>
+  <CacheCluster><CacheClusterId>%s</CacheClusterId><CacheClusterStatus>available</CacheClusterStatus></CacheCluster>
+</CacheClusters></DescribeCacheClustersResult></DescribeCacheClustersResponse>`, id)
+		}
+	}))
+	defer srv.Close()
+
+	conn := testFakeElasticacheConn(srv.URL)
+	c := newDescribeCache()
+
+	for _, id := range []string{"tf-test-a", "tf-test-b"} {
+		rg, err := c.replicationGroup(context.Background(), conn, id)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if rg == nil || *rg.ReplicationGroupId != id {
+			t.Fatalf("unexpected replication group for %s: %v", id, rg)
+		}
+	}
+	clusters, err := c.memberClusters(context.Background(), conn, "tf-test-a", []string{"tf-test-a-001"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if clusters["tf-test-a-001"] == nil {
+		t.Fatalf("expected the member to be cached, got %v", clusters)
+	}
+
+	expected := []string{
+		"DescribeReplicationGroups ",
+		"DescribeReplicationGroups page-2",
+		"DescribeCacheClusters ",
+	}
+	if fmt.Sprint(requests) != fmt.Sprint(expected) {
+		t.Fatalf("expected a single sweep %v, got %v", expected, requests)
+	}
+
+	// Groups are described directly once they have been mutated
+	requests = nil
+	c.invalidate("tf-test-a")
+	if _, err := c.replicationGroup(context.Background(), conn, "tf-test-a"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := c.memberClusters(context.Background(), conn, "tf-test-a", []string{"tf-test-a-001"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := c.replicationGroup(context.Background(), conn, "tf-test-b"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected = []string{
+		"DescribeReplicationGroups tf-test-a",
+		"DescribeCacheClusters tf-test-a-001",
+	}
+	if fmt.Sprint(requests) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, requests)
+	}
+}
+
+func TestDescribeCache_disabled(t *testing.T) {
+	var c *describeCache
+	c.invalidate("tf-test")
+	if c.cached("tf-test") {
+		t.Fatal("a nil cache must not serve anything")
+	}
+}
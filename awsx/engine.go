@@ -0,0 +1,115 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+// engineParameterGroupFamily derives the parameter group family
+// (e.g. redis5.0, redis6.x, redis7 or valkey8) that an engine version
+// belongs to. It fails on versions the engine has never had.
+func engineParameterGroupFamily(engine, version string) (string, error) {
+	parts := strings.Split(version, ".")
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) < 2 {
+		return "", fmt.Errorf("%q is not a valid %s engine version", version, engine)
+	}
+
+	switch engine {
+	case "valkey":
+		minor, _ := strconv.Atoi(parts[1])
+		if major < 7 || (major == 7 && minor < 2) {
+			return "", fmt.Errorf("%q is not a valid valkey engine version, valkey starts with 7.2", version)
+		}
+		return fmt.Sprintf("valkey%d", major), nil
+	case "redis":
+		switch {
+		case major > 7:
+			return "", fmt.Errorf("%q is not a valid redis engine version, use the valkey engine for 8.0 and later", version)
+		case major == 7:
+			return "redis7", nil
+		case major == 6:
+			return "redis6.x", nil
+		case major >= 2:
+			if _, err := strconv.Atoi(parts[1]); err != nil {
+				return "", fmt.Errorf("%q is not a valid redis engine version", version)
+			}
+			return fmt.Sprintf("redis%d.%s", major, parts[1]), nil
+		}
+		return "", fmt.Errorf("%q is not a valid redis engine version", version)
+	}
+
+	return "", fmt.Errorf("unsupported engine %q", engine)
+}
+
+// validateEngineConfiguration checks that the engine version and the
+// parameter group family belong to the engine. Either of the two
+// may be empty, when they are left for AWS to default.
+func validateEngineConfiguration(ctx context.Context, conn *elasticache.ElastiCache, engine, version, parameterGroupName string) error {
+	var family string
+	if version != "" {
+		var err error
+		if family, err = engineParameterGroupFamily(engine, version); err != nil {
+			return err
+		}
+	}
+
+	if parameterGroupName == "" {
+		return nil
+	}
+
+	res, err := conn.DescribeCacheParameterGroupsWithContext(ctx, &elasticache.DescribeCacheParameterGroupsInput{
+		CacheParameterGroupName: aws.String(parameterGroupName),
+	})
+	if err != nil {
+		return fmt.Errorf("Error describing parameter group (%s): %s", parameterGroupName, err)
+	}
+	if len(res.CacheParameterGroups) == 0 {
+		return fmt.Errorf("Parameter group (%s) not found", parameterGroupName)
+	}
+
+	groupFamily := aws.StringValue(res.CacheParameterGroups[0].CacheParameterGroupFamily)
+	if family != "" && groupFamily != family {
+		return fmt.Errorf("parameter group (%s) is of the %s family, but %s %s requires %s",
+			parameterGroupName, groupFamily, engine, version, family)
+	}
+	if family == "" && !strings.HasPrefix(groupFamily, engine) {
+		return fmt.Errorf("parameter group (%s) is of the %s family that doesn't belong to the %s engine",
+			parameterGroupName, groupFamily, engine)
+	}
+
+	return nil
+}
+
+// modifyReplicationGroup sends ModifyReplicationGroup. An engine change
+// (e.g. redis to valkey) is added to the request parameters directly,
+// since the SDK's ModifyReplicationGroupInput predates engine changes.
+func modifyReplicationGroup(ctx context.Context, conn *elasticache.ElastiCache, req *elasticache.ModifyReplicationGroupInput, engine string) error {
+	r, _ := conn.ModifyReplicationGroupRequest(req)
+	r.SetContext(ctx)
+	if engine != "" {
+		r.Handlers.Build.PushBack(func(r *request.Request) {
+			body, err := ioutil.ReadAll(r.GetBody())
+			if err != nil {
+				r.Error = err
+				return
+			}
+			params, err := url.ParseQuery(string(body))
+			if err != nil {
+				r.Error = err
+				return
+			}
+			params.Set("Engine", engine)
+			r.SetBufferBody([]byte(params.Encode()))
+		})
+	}
+	return r.Send()
+}
@@ -0,0 +1,76 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+func TestEngineParameterGroupFamily(t *testing.T) {
+	cases := []struct {
+		Engine, Version, Family string
+		ErrCount                int
+	}{
+		{"redis", "2.8.24", "redis2.8", 0},
+		{"redis", "5.0.6", "redis5.0", 0},
+		{"redis", "6.x", "redis6.x", 0},
+		{"redis", "6.2", "redis6.x", 0},
+		{"redis", "7.1", "redis7", 0},
+		{"redis", "8.0", "", 1},
+		{"redis", "7", "", 1},
+		{"valkey", "7.2", "valkey7", 0},
+		{"valkey", "8.0.1", "valkey8", 0},
+		{"valkey", "7.0", "", 1},
+		{"valkey", "6.x", "", 1},
+		{"memcached", "1.4.14", "", 1},
+	}
+
+	for _, tc := range cases {
+		family, err := engineParameterGroupFamily(tc.Engine, tc.Version)
+		if (err != nil) != (tc.ErrCount > 0) {
+			t.Fatalf("%s %s: unexpected error: %v", tc.Engine, tc.Version, err)
+		}
+		if family != tc.Family {
+			t.Fatalf("%s %s: expected family %q, got %q", tc.Engine, tc.Version, tc.Family, family)
+		}
+	}
+}
+
+func TestModifyReplicationGroup_engine(t *testing.T) {
+	var params url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ = url.ParseQuery(string(body))
+		fmt.Fprint(w, `<ModifyReplicationGroupResponse><ModifyReplicationGroupResult>
+  <ReplicationGroup><ReplicationGroupId>tf-test</ReplicationGroupId></ReplicationGroup>
+</ModifyReplicationGroupResult></ModifyReplicationGroupResponse>`)
+	}))
+	defer srv.Close()
+
+	conn := testFakeElasticacheConn(srv.URL)
+	req := &elasticache.ModifyReplicationGroupInput{
+		ReplicationGroupId: aws.String("tf-test"),
+		EngineVersion:      aws.String("7.2"),
+	}
+
+	if err := modifyReplicationGroup(context.Background(), conn, req, "valkey"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if params.Get("Action") != "ModifyReplicationGroup" || params.Get("Engine") != "valkey" || params.Get("EngineVersion") != "7.2" {
+		t.Fatalf("unexpected request parameters: %v", params)
+	}
+
+	if err := modifyReplicationGroup(context.Background(), conn, req, ""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := params["Engine"]; ok {
+		t.Fatalf("engine is not expected without a change: %v", params)
+	}
+}
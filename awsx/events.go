@@ -0,0 +1,172 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+// Number of the most recent ElastiCache events kept
+// to be attached to error messages.
+const elasticacheEventLogSize = 10
+
+// Events can show up in DescribeEvents a little after the time they are
+// dated with, so every poll looks back this far behind the newest event.
+const elasticacheEventLogOverlap = time.Minute
+
+// elasticacheEventLog follows DescribeEvents for a replication group
+// and its member cache clusters while we are waiting on an operation.
+// Every event is logged once, the last few are kept for error reporting.
+//
+// The refresh func may still be running when a timed out wait returns
+// and the error is rendered, hence the lock.
+type elasticacheEventLog struct {
+	ctx         context.Context
+	conn        *elasticache.ElastiCache
+	replGroupID string
+
+	mu      sync.Mutex
+	since   time.Time
+	members map[string]bool
+	seen    map[string]bool
+	recent  []*elasticache.Event
+}
+
+// newElasticacheEventLog has to be called before the operation
+// is requested, so that none of its events are missed.
+func newElasticacheEventLog(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string) *elasticacheEventLog {
+	return &elasticacheEventLog{
+		ctx:         ctx,
+		conn:        conn,
+		replGroupID: replGroupID,
+		since:       time.Now(),
+		members:     make(map[string]bool),
+		seen:        make(map[string]bool),
+	}
+}
+
+// refreshFunc wraps a replication group refresh func, so that events
+// are polled alongside the status. Member clusters are learned from
+// the replication group returned by the wrapped func.
+func (l *elasticacheEventLog) refreshFunc(f resource.StateRefreshFunc) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		result, state, err := f()
+		if rg, ok := result.(*elasticache.ReplicationGroup); ok && rg != nil {
+			l.mu.Lock()
+			for _, id := range rg.MemberClusters {
+				l.members[*id] = true
+			}
+			l.mu.Unlock()
+		}
+		l.poll()
+		return result, state, err
+	}
+}
+
+func (l *elasticacheEventLog) poll() {
+	l.mu.Lock()
+	since := l.since
+	members := make([]string, 0, len(l.members))
+	for id := range l.members {
+		members = append(members, id)
+	}
+	l.mu.Unlock()
+	sort.Strings(members)
+
+	// Filtering by a source identifier is limited to a single id,
+	// so the group and every member are requested one by one.
+	events := l.describe(elasticache.SourceTypeReplicationGroup, l.replGroupID, since)
+	for _, id := range members {
+		events = append(events, l.describe(elasticache.SourceTypeCacheCluster, id, since)...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.Before(*events[j].Date)
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range events {
+		l.record(e)
+	}
+	l.advance()
+}
+
+// advance moves the start of the next poll up to the newest recorded
+// event, less the overlap; the events seen twice are skipped by record.
+func (l *elasticacheEventLog) advance() {
+	if len(l.recent) == 0 {
+		return
+	}
+	if since := l.recent[len(l.recent)-1].Date.Add(-elasticacheEventLogOverlap); since.After(l.since) {
+		l.since = since
+	}
+}
+
+func (l *elasticacheEventLog) describe(sourceType, sourceID string, since time.Time) []*elasticache.Event {
+	req := &elasticache.DescribeEventsInput{
+		SourceType:       aws.String(sourceType),
+		SourceIdentifier: aws.String(sourceID),
+		StartTime:        aws.Time(since),
+	}
+
+	var events []*elasticache.Event
+	err := l.conn.DescribeEventsPagesWithContext(l.ctx, req, func(page *elasticache.DescribeEventsOutput, lastPage bool) bool {
+		for _, e := range page.Events {
+			if e.Date != nil && e.SourceIdentifier != nil && e.Message != nil {
+				events = append(events, e)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		// Events are informational only, they must never fail the operation
+		log.Printf("[WARN] Error describing ElastiCache events (%s) for replication group (%s): %s", sourceType, l.replGroupID, err)
+	}
+	return events
+}
+
+// record has to be called with the lock held.
+func (l *elasticacheEventLog) record(e *elasticache.Event) {
+	if aws.StringValue(e.SourceType) == elasticache.SourceTypeCacheCluster && !l.members[*e.SourceIdentifier] {
+		return
+	}
+
+	key := fmt.Sprintf("%d/%s/%s", e.Date.UnixNano(), *e.SourceIdentifier, *e.Message)
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+
+	log.Printf("[INFO] ElastiCache event %s %s: %s", e.Date.UTC().Format(time.RFC3339), *e.SourceIdentifier, *e.Message)
+
+	l.recent = append(l.recent, e)
+	if len(l.recent) > elasticacheEventLogSize {
+		l.recent = l.recent[len(l.recent)-elasticacheEventLogSize:]
+	}
+}
+
+// String renders the recent events as a suffix for error messages.
+func (l *elasticacheEventLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.recent) == 0 {
+		return ""
+	}
+
+	lines := make([]string, 0, len(l.recent))
+	for _, e := range l.recent {
+		lines = append(lines, fmt.Sprintf("  %s %s: %s", e.Date.UTC().Format(time.RFC3339), *e.SourceIdentifier, *e.Message))
+	}
+	return "\nRecent ElastiCache events:\n" + strings.Join(lines, "\n")
+}
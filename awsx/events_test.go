@@ -0,0 +1,100 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+func TestElasticacheEventLog_record(t *testing.T) {
+	l := newElasticacheEventLog(context.Background(), nil, "tf-test")
+	l.members["tf-test-001"] = true
+
+	at := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	event := func(sourceType, id, msg string, offset int) *elasticache.Event {
+		return &elasticache.Event{
+			Date:             aws.Time(at.Add(time.Duration(offset) * time.Second)),
+			SourceType:       aws.String(sourceType),
+			SourceIdentifier: aws.String(id),
+			Message:          aws.String(msg),
+		}
+	}
+
+	l.record(event(elasticache.SourceTypeReplicationGroup, "tf-test", "Replication group created", 0))
+	l.record(event(elasticache.SourceTypeReplicationGroup, "tf-test", "Replication group created", 0))
+	l.record(event(elasticache.SourceTypeCacheCluster, "tf-test-001", "Cache cluster created", 1))
+	l.record(event(elasticache.SourceTypeCacheCluster, "unrelated-001", "Cache cluster created", 2))
+
+	if len(l.recent) != 2 {
+		t.Fatalf("expected 2 recorded events, got %d", len(l.recent))
+	}
+
+	expected := "\nRecent ElastiCache events:\n" +
+		"  2017-03-01T12:00:00Z tf-test: Replication group created\n" +
+		"  2017-03-01T12:00:01Z tf-test-001: Cache cluster created"
+	if l.String() != expected {
+		t.Fatalf("unexpected summary:\n%s", l.String())
+	}
+
+	for i := 0; i < elasticacheEventLogSize+5; i++ {
+		l.record(event(elasticache.SourceTypeReplicationGroup, "tf-test", fmt.Sprintf("event %d", i), 10+i))
+	}
+	if len(l.recent) != elasticacheEventLogSize {
+		t.Fatalf("expected %d recorded events, got %d", elasticacheEventLogSize, len(l.recent))
+	}
+	if !strings.HasSuffix(l.String(), fmt.Sprintf("event %d", elasticacheEventLogSize+4)) {
+		t.Fatalf("expected the latest event to be kept:\n%s", l.String())
+	}
+}
+
+func TestElasticacheEventLog_advance(t *testing.T) {
+	l := newElasticacheEventLog(context.Background(), nil, "tf-test")
+	start := l.since
+
+	l.advance()
+	if !l.since.Equal(start) {
+		t.Fatalf("expected the start to stay at %s without events, got %s", start, l.since)
+	}
+
+	newest := start.Add(10 * time.Minute)
+	l.record(&elasticache.Event{
+		Date:             aws.Time(newest),
+		SourceType:       aws.String(elasticache.SourceTypeReplicationGroup),
+		SourceIdentifier: aws.String("tf-test"),
+		Message:          aws.String("Replication group modified"),
+	})
+	l.advance()
+	if expected := newest.Add(-elasticacheEventLogOverlap); !l.since.Equal(expected) {
+		t.Fatalf("expected the start to move to %s, got %s", expected, l.since)
+	}
+}
+
+func TestElasticacheEventLog_concurrentString(t *testing.T) {
+	l := newElasticacheEventLog(context.Background(), nil, "tf-test")
+	at := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.mu.Lock()
+			l.record(&elasticache.Event{
+				Date:             aws.Time(at.Add(time.Duration(i) * time.Second)),
+				SourceType:       aws.String(elasticache.SourceTypeReplicationGroup),
+				SourceIdentifier: aws.String("tf-test"),
+				Message:          aws.String(fmt.Sprintf("event %d", i)),
+			})
+			l.advance()
+			l.mu.Unlock()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = l.String()
+	}
+	<-done
+}
@@ -0,0 +1,83 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+// flattenGlobalReplicationGroupInfo returns the values of
+// global_replication_group_id, global_replication_group_member_of and
+// global_replication_group_role. The configurable id is left empty for a
+// primary: it can't be set in the configuration of one, and removing it
+// would mean detaching the primary. member_of reports it for any member.
+func flattenGlobalReplicationGroupInfo(info *elasticache.GlobalReplicationGroupInfo) (string, string, string) {
+	if info == nil || info.GlobalReplicationGroupId == nil {
+		return "", "", ""
+	}
+	memberOf := *info.GlobalReplicationGroupId
+	role := strings.ToLower(aws.StringValue(info.GlobalReplicationGroupMemberRole))
+	if role == "primary" {
+		return "", memberOf, role
+	}
+	return memberOf, memberOf, role
+}
+
+// disassociateGlobalReplicationGroup detaches a secondary from its Global
+// Datastore and waits until it is a standalone replication group.
+func disassociateGlobalReplicationGroup(ctx context.Context, conn *elasticache.ElastiCache, globalID, replGroupID string, timeout time.Duration) error {
+	log.Printf("[DEBUG] Detaching ElastiCache Replication Group (%s) from Global Datastore (%s)", replGroupID, globalID)
+	deadline := time.Now().Add(timeout)
+	err := retryWhileReplicationGroupBusy(ctx, conn, replGroupID, deadline, func() error {
+		_, err := conn.DisassociateGlobalReplicationGroupWithContext(ctx, &elasticache.DisassociateGlobalReplicationGroupInput{
+			GlobalReplicationGroupId: aws.String(globalID),
+			ReplicationGroupId:       aws.String(replGroupID),
+			ReplicationGroupRegion:   conn.Config.Region,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Error detaching elasticache (%s) from Global Datastore (%s): %s", replGroupID, globalID, err)
+	}
+
+	events := newElasticacheEventLog(ctx, conn, replGroupID)
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{"modifying", "attached"},
+		Target:     []string{"available"},
+		Refresh:    events.refreshFunc(globalMembershipRefreshFunc(ctx, conn, replGroupID)),
+		Timeout:    time.Until(deadline),
+		Delay:      10 * time.Second,
+		MinTimeout: 3 * time.Second,
+	}
+
+	if _, err := waitForState(ctx, stateConf, "the replication group"); err != nil {
+		return fmt.Errorf("Error waiting for elasticache (%s) to leave Global Datastore (%s): %s%s", replGroupID, globalID, err, events)
+	}
+	return nil
+}
+
+// globalMembershipRefreshFunc reports "attached" for an otherwise
+// available replication group that is still a Global Datastore member.
+func globalMembershipRefreshFunc(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		rg, err := describeReplicationGroup(ctx, conn, replGroupID)
+		if err != nil {
+			return nil, "", err
+		}
+		if rg == nil {
+			return nil, "", fmt.Errorf("[WARN] Error: no matching Elastic Cache replication group for id (%s)", replGroupID)
+		}
+
+		if *rg.Status == "available" && rg.GlobalReplicationGroupInfo != nil && rg.GlobalReplicationGroupInfo.GlobalReplicationGroupId != nil {
+			return rg, "attached", nil
+		}
+		return rg, *rg.Status, nil
+	}
+}
@@ -0,0 +1,120 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestFlattenGlobalReplicationGroupInfo(t *testing.T) {
+	cases := []struct {
+		info               *elasticache.GlobalReplicationGroupInfo
+		id, memberOf, role string
+	}{
+		{nil, "", "", ""},
+		{&elasticache.GlobalReplicationGroupInfo{}, "", "", ""},
+		{&elasticache.GlobalReplicationGroupInfo{
+			GlobalReplicationGroupId:         aws.String("ldgnf-tf-test"),
+			GlobalReplicationGroupMemberRole: aws.String("SECONDARY"),
+		}, "ldgnf-tf-test", "ldgnf-tf-test", "secondary"},
+		{&elasticache.GlobalReplicationGroupInfo{
+			GlobalReplicationGroupId:         aws.String("ldgnf-tf-test"),
+			GlobalReplicationGroupMemberRole: aws.String("PRIMARY"),
+		}, "", "ldgnf-tf-test", "primary"},
+	}
+
+	for i, c := range cases {
+		id, memberOf, role := flattenGlobalReplicationGroupInfo(c.info)
+		if id != c.id || memberOf != c.memberOf || role != c.role {
+			t.Fatalf("%d: expected %q %q %q, got %q %q %q", i, c.id, c.memberOf, c.role, id, memberOf, role)
+		}
+	}
+}
+
+func TestGlobalMembershipRefreshFunc(t *testing.T) {
+	groups := map[string]string{
+		"tf-test-attached":  `<Status>available</Status><GlobalReplicationGroupInfo><GlobalReplicationGroupId>ldgnf-tf-test</GlobalReplicationGroupId><GlobalReplicationGroupMemberRole>SECONDARY</GlobalReplicationGroupMemberRole></GlobalReplicationGroupInfo>`,
+		"tf-test-modifying": `<Status>modifying</Status><GlobalReplicationGroupInfo><GlobalReplicationGroupId>ldgnf-tf-test</GlobalReplicationGroupId></GlobalReplicationGroupInfo>`,
+		"tf-test-detached":  `<Status>available</Status>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		id := params.Get("ReplicationGroupId")
+		g, ok := groups[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>ReplicationGroupNotFoundFault</Code><Message>not found</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprintf(w, `<DescribeReplicationGroupsResponse><DescribeReplicationGroupsResult>
+  <ReplicationGroups><ReplicationGroup><ReplicationGroupId>%s</ReplicationGroupId>%s</ReplicationGroup></ReplicationGroups>
+</DescribeReplicationGroupsResult></DescribeReplicationGroupsResponse>`, id, g)
+	}))
+	defer srv.Close()
+	conn := testFakeElasticacheConn(srv.URL)
+
+	for id, expected := range map[string]string{
+		"tf-test-attached":  "attached",
+		"tf-test-modifying": "modifying",
+		"tf-test-detached":  "available",
+	} {
+		_, state, err := globalMembershipRefreshFunc(context.Background(), conn, id)()
+		if err != nil {
+			t.Fatalf("%s: err: %s", id, err)
+		}
+		if state != expected {
+			t.Fatalf("%s: expected %s, got %s", id, expected, state)
+		}
+	}
+
+	if _, _, err := globalMembershipRefreshFunc(context.Background(), conn, "tf-test-gone")(); err == nil {
+		t.Fatal("expected an error for a missing group")
+	}
+}
+
+func TestUpdateReplicationGroupGlobalMembership(t *testing.T) {
+	cases := []struct {
+		role, changedID string
+		err             string
+	}{
+		{role: "primary", err: "is the primary of Global Datastore (ldgnf-tf-test)"},
+		{role: "secondary", changedID: "ldgnf-tf-other", err: "can only join a Global Datastore when it is created"},
+	}
+
+	for i, c := range cases {
+		state := map[string]string{
+			"replication_group_id":               "tf-test",
+			"global_replication_group_id":        "ldgnf-tf-test",
+			"global_replication_group_role":      c.role,
+			"global_replication_group_member_of": "ldgnf-tf-test",
+		}
+		err := testReplicationGroupUpdate(state, map[string]string{"global_replication_group_id": c.changedID}, func(d *schema.ResourceData) error {
+			return updateReplicationGroupGlobalMembership(context.Background(), d, nil)
+		})
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%d: expected error %q, got %v", i, c.err, err)
+		}
+	}
+
+	// Nothing to do for a primary, its id is left empty by Read
+	state := map[string]string{
+		"replication_group_id":          "tf-test",
+		"global_replication_group_role": "primary",
+	}
+	err := testReplicationGroupUpdate(state, map[string]string{"node_type": "cache.m5.large"}, func(d *schema.ResourceData) error {
+		return updateReplicationGroupGlobalMembership(context.Background(), d, nil)
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,182 @@
+package awsx
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+)
+
+func logDeliveryConfigurationSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		MaxItems: 2,
+		Set:      logDeliveryConfigurationHash,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"log_type": &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+					ValidateFunc: validation.StringInSlice([]string{
+						elasticache.LogTypeSlowLog,
+						elasticache.LogTypeEngineLog,
+					}, false),
+				},
+				"destination_type": &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+					ValidateFunc: validation.StringInSlice([]string{
+						elasticache.DestinationTypeCloudwatchLogs,
+						elasticache.DestinationTypeKinesisFirehose,
+					}, false),
+				},
+				// A CloudWatch Logs log group or a Kinesis Firehose
+				// delivery stream name, depending on destination_type
+				"destination": &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"log_format": &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+					ValidateFunc: validation.StringInSlice([]string{
+						elasticache.LogFormatJson,
+						elasticache.LogFormatText,
+					}, false),
+				},
+				"status": &schema.Schema{
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+			},
+		},
+	}
+}
+
+// The status is intentionally left out of the hash,
+// otherwise every status change would look like a diff.
+func logDeliveryConfigurationHash(v interface{}) int {
+	var buf bytes.Buffer
+	m := v.(map[string]interface{})
+	buf.WriteString(fmt.Sprintf("%s-", m["log_type"].(string)))
+	buf.WriteString(fmt.Sprintf("%s-", m["destination_type"].(string)))
+	buf.WriteString(fmt.Sprintf("%s-", m["destination"].(string)))
+	buf.WriteString(fmt.Sprintf("%s-", m["log_format"].(string)))
+	return hashcode.String(buf.String())
+}
+
+func expandLogDeliveryConfiguration(m map[string]interface{}) *elasticache.LogDeliveryConfigurationRequest {
+	req := &elasticache.LogDeliveryConfigurationRequest{
+		LogType:            aws.String(m["log_type"].(string)),
+		DestinationType:    aws.String(m["destination_type"].(string)),
+		LogFormat:          aws.String(m["log_format"].(string)),
+		DestinationDetails: &elasticache.DestinationDetails{},
+		Enabled:            aws.Bool(true),
+	}
+
+	destination := aws.String(m["destination"].(string))
+	if *req.DestinationType == elasticache.DestinationTypeCloudwatchLogs {
+		req.DestinationDetails.CloudWatchLogsDetails = &elasticache.CloudWatchLogsDestinationDetails{
+			LogGroup: destination,
+		}
+	} else {
+		req.DestinationDetails.KinesisFirehoseDetails = &elasticache.KinesisFirehoseDestinationDetails{
+			DeliveryStream: destination,
+		}
+	}
+
+	return req
+}
+
+func expandLogDeliveryConfigurations(configured []interface{}) ([]*elasticache.LogDeliveryConfigurationRequest, error) {
+	if err := validateLogDeliveryLogTypes(configured); err != nil {
+		return nil, err
+	}
+	reqs := make([]*elasticache.LogDeliveryConfigurationRequest, 0, len(configured))
+	for _, v := range configured {
+		reqs = append(reqs, expandLogDeliveryConfiguration(v.(map[string]interface{})))
+	}
+	return reqs, nil
+}
+
+// validateLogDeliveryLogTypes rejects two blocks of the same log_type,
+// which MaxItems lets through and ElastiCache refuses.
+func validateLogDeliveryLogTypes(configured []interface{}) error {
+	seen := make(map[string]bool, len(configured))
+	for _, v := range configured {
+		logType := v.(map[string]interface{})["log_type"].(string)
+		if seen[logType] {
+			return fmt.Errorf("log_delivery_configuration: only one block per log_type is allowed, %q is configured twice", logType)
+		}
+		seen[logType] = true
+	}
+	return nil
+}
+
+// diffLogDeliveryConfigurations turns a change of the configured set into
+// requests for ModifyReplicationGroup: log types that are gone are
+// disabled, new or changed configurations are sent in full.
+func diffLogDeliveryConfigurations(o, n *schema.Set) ([]*elasticache.LogDeliveryConfigurationRequest, error) {
+	if err := validateLogDeliveryLogTypes(n.List()); err != nil {
+		return nil, err
+	}
+
+	var reqs []*elasticache.LogDeliveryConfigurationRequest
+
+	configuredTypes := make(map[string]bool)
+	for _, v := range n.List() {
+		configuredTypes[v.(map[string]interface{})["log_type"].(string)] = true
+	}
+
+	for _, v := range o.Difference(n).List() {
+		logType := v.(map[string]interface{})["log_type"].(string)
+		if !configuredTypes[logType] {
+			reqs = append(reqs, &elasticache.LogDeliveryConfigurationRequest{
+				LogType: aws.String(logType),
+				Enabled: aws.Bool(false),
+			})
+		}
+	}
+
+	added, err := expandLogDeliveryConfigurations(n.Difference(o).List())
+	if err != nil {
+		return nil, err
+	}
+	return append(reqs, added...), nil
+}
+
+// Configurations that are being or have been disabled are not reported.
+func flattenLogDeliveryConfigurations(configs []*elasticache.LogDeliveryConfiguration) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(configs))
+	for _, c := range configs {
+		status := aws.StringValue(c.Status)
+		if status == elasticache.LogDeliveryConfigurationStatusDisabling || status == "disabled" {
+			continue
+		}
+
+		var destination string
+		if details := c.DestinationDetails; details != nil {
+			if details.CloudWatchLogsDetails != nil {
+				destination = aws.StringValue(details.CloudWatchLogsDetails.LogGroup)
+			}
+			if details.KinesisFirehoseDetails != nil {
+				destination = aws.StringValue(details.KinesisFirehoseDetails.DeliveryStream)
+			}
+		}
+
+		result = append(result, map[string]interface{}{
+			"log_type":         aws.StringValue(c.LogType),
+			"destination_type": aws.StringValue(c.DestinationType),
+			"destination":      destination,
+			"log_format":       aws.StringValue(c.LogFormat),
+			"status":           status,
+		})
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package awsx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestDiffLogDeliveryConfigurations(t *testing.T) {
+	slowLog := map[string]interface{}{
+		"log_type":         "slow-log",
+		"destination_type": "cloudwatch-logs",
+		"destination":      "redis-slow-log",
+		"log_format":       "json",
+	}
+	engineLog := map[string]interface{}{
+		"log_type":         "engine-log",
+		"destination_type": "kinesis-firehose",
+		"destination":      "redis-engine-log",
+		"log_format":       "text",
+	}
+	slowLogText := map[string]interface{}{
+		"log_type":         "slow-log",
+		"destination_type": "cloudwatch-logs",
+		"destination":      "redis-slow-log",
+		"log_format":       "text",
+	}
+
+	o := schema.NewSet(logDeliveryConfigurationHash, []interface{}{slowLog, engineLog})
+	n := schema.NewSet(logDeliveryConfigurationHash, []interface{}{slowLogText})
+
+	reqs, err := diffLogDeliveryConfigurations(o, n)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d: %s", len(reqs), reqs)
+	}
+
+	// engine-log is gone and has to be disabled
+	if *reqs[0].LogType != "engine-log" || *reqs[0].Enabled || reqs[0].DestinationDetails != nil {
+		t.Fatalf("expected engine-log to be disabled, got: %s", reqs[0])
+	}
+
+	// slow-log has changed and is sent in full, without disabling it first
+	if *reqs[1].LogType != "slow-log" || !*reqs[1].Enabled || *reqs[1].LogFormat != "text" ||
+		aws.StringValue(reqs[1].DestinationDetails.CloudWatchLogsDetails.LogGroup) != "redis-slow-log" {
+		t.Fatalf("expected slow-log to be reconfigured, got: %s", reqs[1])
+	}
+}
+
+func TestLogDeliveryConfigurations_duplicateLogType(t *testing.T) {
+	slowLog := func(destination string) map[string]interface{} {
+		return map[string]interface{}{
+			"log_type":         "slow-log",
+			"destination_type": "cloudwatch-logs",
+			"destination":      destination,
+			"log_format":       "json",
+		}
+	}
+	configured := []interface{}{slowLog("redis-slow-log"), slowLog("redis-slow-log-2")}
+
+	if _, err := expandLogDeliveryConfigurations(configured); err == nil || !strings.Contains(err.Error(), `"slow-log" is configured twice`) {
+		t.Fatalf("expected the duplicate to be rejected, got %v", err)
+	}
+
+	o := schema.NewSet(logDeliveryConfigurationHash, []interface{}{slowLog("redis-slow-log")})
+	n := schema.NewSet(logDeliveryConfigurationHash, configured)
+	if _, err := diffLogDeliveryConfigurations(o, n); err == nil {
+		t.Fatal("expected the duplicate to be rejected on update")
+	}
+}
@@ -0,0 +1,60 @@
+package awsx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+// Enough to describe typical groups in a single round
+// while staying well below the API throttling limits.
+const memberClusterDescribeConcurrency = 4
+
+// describeMemberClusters describes the member clusters of a replication
+// group, running at most concurrency requests at a time. The result is
+// keyed by cluster id, members that don't exist (anymore) are missing.
+func describeMemberClusters(ctx context.Context, conn *elasticache.ElastiCache, ids []string, concurrency int) (map[string]*elasticache.CacheCluster, error) {
+	clusters := make(map[string]*elasticache.CacheCluster, len(ids))
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	sem := make(chan struct{}, concurrency)
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			res, err := conn.DescribeCacheClustersWithContext(ctx, &elasticache.DescribeCacheClustersInput{
+				CacheClusterId:    aws.String(id),
+				ShowCacheNodeInfo: aws.Bool(true),
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			if len(res.CacheClusters) == 1 {
+				clusters[id] = res.CacheClusters[0]
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return clusters, nil
+}
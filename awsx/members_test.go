@@ -0,0 +1,99 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testFakeDescribeCacheClusters serves DescribeCacheClusters for any
+// cluster id with the given latency, like a distant API endpoint would.
+func testFakeDescribeCacheClusters(latency time.Duration, inFlight, maxInFlight *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(inFlight, 1)
+		defer atomic.AddInt32(inFlight, -1)
+		for {
+			max := atomic.LoadInt32(maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(maxInFlight, max, n) {
+				break
+			}
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		time.Sleep(latency)
+		fmt.Fprintf(w, `<DescribeCacheClustersResponse><DescribeCacheClustersResult><CacheClusters>
+  <CacheCluster><CacheClusterId>%s</CacheClusterId><CacheClusterStatus>available</CacheClusterStatus></CacheCluster>
+</CacheClusters></DescribeCacheClustersResult></DescribeCacheClustersResponse>`, params.Get("CacheClusterId"))
+	}))
+}
+
+func testMemberIds(n int) []string {
+	ids := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		ids = append(ids, fmt.Sprintf("tf-test-%03d", i))
+	}
+	return ids
+}
+
+func TestDescribeMemberClusters(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := testFakeDescribeCacheClusters(10*time.Millisecond, &inFlight, &maxInFlight)
+	defer srv.Close()
+
+	ids := testMemberIds(6)
+	clusters, err := describeMemberClusters(context.Background(), testFakeElasticacheConn(srv.URL), ids, 2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(clusters) != len(ids) {
+		t.Fatalf("expected %d clusters, got %d", len(ids), len(clusters))
+	}
+	for _, id := range ids {
+		if c := clusters[id]; c == nil || *c.CacheClusterId != id || *c.CacheClusterStatus != "available" {
+			t.Fatalf("unexpected cluster for %s: %v", id, c)
+		}
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("expected at most 2 concurrent requests, got %d", maxInFlight)
+	}
+}
+
+func TestDescribeMemberClusters_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error></ErrorResponse>`)
+	}))
+	defer srv.Close()
+
+	if _, err := describeMemberClusters(context.Background(), testFakeElasticacheConn(srv.URL), testMemberIds(3), 2); !isAWSErr(err, "Throttling", "") {
+		t.Fatalf("expected the throttling error, got %v", err)
+	}
+}
+
+// go test ./awsx -run NONE -bench DescribeMemberClusters
+func BenchmarkDescribeMemberClusters(b *testing.B) {
+	var inFlight, maxInFlight int32
+	srv := testFakeDescribeCacheClusters(5*time.Millisecond, &inFlight, &maxInFlight)
+	defer srv.Close()
+
+	conn := testFakeElasticacheConn(srv.URL)
+	ids := testMemberIds(6)
+
+	for _, concurrency := range []int{1, memberClusterDescribeConcurrency} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := describeMemberClusters(context.Background(), conn, ids, concurrency); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+// validateReplicationGroupNetwork checks the network type and the IP
+// discovery against each other and against what the subnet group
+// supports. Empty values are left for AWS to default.
+func validateReplicationGroupNetwork(ctx context.Context, conn *elasticache.ElastiCache, subnetGroupName, networkType, ipDiscovery string) error {
+	if networkType == elasticache.NetworkTypeIpv4 && ipDiscovery == elasticache.IpDiscoveryIpv6 {
+		return fmt.Errorf("ip_discovery %q requires network_type %q or %q",
+			ipDiscovery, elasticache.NetworkTypeIpv6, elasticache.NetworkTypeDualStack)
+	}
+	if networkType == elasticache.NetworkTypeIpv6 && ipDiscovery == elasticache.IpDiscoveryIpv4 {
+		return fmt.Errorf("ip_discovery %q can't be used with network_type %q", ipDiscovery, networkType)
+	}
+
+	if networkType == "" || networkType == elasticache.NetworkTypeIpv4 {
+		return nil
+	}
+	if subnetGroupName == "" {
+		return fmt.Errorf("network_type %q requires a subnet_group_name", networkType)
+	}
+
+	res, err := conn.DescribeCacheSubnetGroupsWithContext(ctx, &elasticache.DescribeCacheSubnetGroupsInput{
+		CacheSubnetGroupName: aws.String(subnetGroupName),
+	})
+	if err != nil {
+		return fmt.Errorf("Error describing subnet group (%s): %s", subnetGroupName, err)
+	}
+	if len(res.CacheSubnetGroups) == 0 {
+		return fmt.Errorf("Subnet group (%s) not found", subnetGroupName)
+	}
+
+	supported := aws.StringValueSlice(res.CacheSubnetGroups[0].SupportedNetworkTypes)
+	for _, t := range supported {
+		if t == networkType {
+			return nil
+		}
+	}
+	return fmt.Errorf("network_type %q is not supported by subnet group (%s), supported: %v",
+		networkType, subnetGroupName, supported)
+}
@@ -0,0 +1,78 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateReplicationGroupNetwork(t *testing.T) {
+	cases := []struct {
+		SubnetGroupName, NetworkType, IpDiscovery string
+		ErrCount                                  int
+	}{
+		{"", "", "", 0},
+		{"", "ipv4", "ipv4", 0},
+		{"", "ipv4", "ipv6", 1},
+		{"tf-test", "ipv6", "ipv4", 1},
+		{"", "dual_stack", "", 1},
+	}
+
+	for _, tc := range cases {
+		// none of the cases gets as far as asking AWS about the subnet group
+		err := validateReplicationGroupNetwork(context.Background(), nil, tc.SubnetGroupName, tc.NetworkType, tc.IpDiscovery)
+		if (err != nil) != (tc.ErrCount > 0) {
+			t.Fatalf("%#v: unexpected result: %v", tc, err)
+		}
+	}
+}
+
+func TestValidateReplicationGroupNetwork_subnetGroup(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		name := params.Get("CacheSubnetGroupName")
+		requested = append(requested, params.Get("Action")+" "+name)
+		if name == "tf-test-gone" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>CacheSubnetGroupNotFoundFault</Code><Message>not found</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprintf(w, `<DescribeCacheSubnetGroupsResponse><DescribeCacheSubnetGroupsResult><CacheSubnetGroups>
+  <CacheSubnetGroup><CacheSubnetGroupName>%s</CacheSubnetGroupName>
+    <SupportedNetworkTypes><member>ipv4</member><member>dual_stack</member></SupportedNetworkTypes>
+  </CacheSubnetGroup>
+</CacheSubnetGroups></DescribeCacheSubnetGroupsResult></DescribeCacheSubnetGroupsResponse>`, name)
+	}))
+	defer srv.Close()
+	conn := testFakeElasticacheConn(srv.URL)
+
+	cases := []struct {
+		subnetGroupName, networkType string
+		err                          string
+	}{
+		{"tf-test", "dual_stack", ""},
+		{"tf-test", "ipv6", `network_type "ipv6" is not supported by subnet group (tf-test), supported: [ipv4 dual_stack]`},
+		{"tf-test-gone", "dual_stack", "CacheSubnetGroupNotFoundFault"},
+	}
+
+	for i, c := range cases {
+		err := validateReplicationGroupNetwork(context.Background(), conn, c.subnetGroupName, c.networkType, "ipv6")
+		if c.err == "" && err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Fatalf("%d: expected error %q, got %v", i, c.err, err)
+		}
+	}
+
+	if len(requested) != len(cases) || requested[0] != "DescribeCacheSubnetGroups tf-test" {
+		t.Fatalf("expected every case to describe the subnet group, got %v", requested)
+	}
+}
@@ -0,0 +1,270 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// ModifyCacheParameterGroup and ResetCacheParameterGroup
+// take at most this many parameters per call.
+const parameterGroupBatchSize = 20
+
+// managedParameterGroupName names the parameter group kept for the
+// parameter blocks after the replication group and the engine family,
+// so that a major upgrade gets a group of the new family.
+func managedParameterGroupName(replGroupID, family string) string {
+	return strings.ToLower(replGroupID) + "-" + strings.Replace(family, ".", "-", -1)
+}
+
+// managedParameterGroup returns the name and the family of the parameter
+// group kept for the parameter blocks, or "" if there are none.
+func managedParameterGroup(d *schema.ResourceData) (string, string, error) {
+	if d.Get("parameter").(*schema.Set).Len() == 0 {
+		return "", "", nil
+	}
+
+	engine := d.Get("engine").(string)
+	if engine == "" {
+		engine = "redis"
+	}
+	version := d.Get("engine_version").(string)
+	if version == "" {
+		return "", "", fmt.Errorf("engine_version is required along with parameter blocks, the parameter group family depends on it")
+	}
+	family, err := engineParameterGroupFamily(engine, version)
+	if err != nil {
+		return "", "", err
+	}
+	return managedParameterGroupName(d.Get("replication_group_id").(string), family), family, nil
+}
+
+// replicationGroupParameterGroup returns the parameter group the
+// replication group has to use and whether it differs from the current
+// one. That's the managed one while there are parameter blocks and the
+// default one of the family once they are removed, unless
+// parameter_group_name is changed along with them.
+func replicationGroupParameterGroup(d *schema.ResourceData) (string, bool, error) {
+	o, n := d.GetChange("parameter_group_name")
+	name := n.(string)
+
+	managed, _, err := managedParameterGroup(d)
+	if err != nil {
+		return "", false, err
+	}
+	if managed != "" {
+		name = managed
+	} else if op, _ := d.GetChange("parameter"); op.(*schema.Set).Len() > 0 && !d.HasChange("parameter_group_name") {
+		family, err := engineParameterGroupFamily(d.Get("engine").(string), d.Get("engine_version").(string))
+		if err != nil {
+			return "", false, err
+		}
+		name = "default." + family
+	}
+	return name, name != o.(string), nil
+}
+
+func expandParameters(l []interface{}) map[string]string {
+	params := make(map[string]string, len(l))
+	for _, v := range l {
+		p := v.(map[string]interface{})
+		params[p["name"].(string)] = p["value"].(string)
+	}
+	return params
+}
+
+func flattenParameters(params map[string]string) []interface{} {
+	l := make([]interface{}, 0, len(params))
+	for name, value := range params {
+		l = append(l, map[string]interface{}{
+			"name":  name,
+			"value": value,
+		})
+	}
+	return l
+}
+
+// parameterChanges compares the user-set values of a parameter group to
+// the configured ones and returns the parameters to modify and the names
+// of the ones to reset to their defaults, both sorted by name.
+func parameterChanges(current, configured map[string]string) ([]*elasticache.ParameterNameValue, []string) {
+	var modify []*elasticache.ParameterNameValue
+	var reset []string
+	for name, value := range configured {
+		if v, ok := current[name]; !ok || v != value {
+			modify = append(modify, &elasticache.ParameterNameValue{
+				ParameterName:  aws.String(name),
+				ParameterValue: aws.String(value),
+			})
+		}
+	}
+	for name := range current {
+		if _, ok := configured[name]; !ok {
+			reset = append(reset, name)
+		}
+	}
+	sort.Slice(modify, func(i, j int) bool { return *modify[i].ParameterName < *modify[j].ParameterName })
+	sort.Strings(reset)
+	return modify, reset
+}
+
+// syncReplicationGroupParameters makes sure the managed parameter group
+// exists and holds exactly the configured parameters. The group starts
+// using it only once parameter_group_name is switched to it.
+func syncReplicationGroupParameters(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache) error {
+	name, family, err := managedParameterGroup(d)
+	if err != nil || name == "" {
+		return err
+	}
+	_, err = conn.CreateCacheParameterGroupWithContext(ctx, &elasticache.CreateCacheParameterGroupInput{
+		CacheParameterGroupName:   aws.String(name),
+		CacheParameterGroupFamily: aws.String(family),
+		Description:               aws.String(fmt.Sprintf("Parameters of ElastiCache Replication Group %s", d.Get("replication_group_id"))),
+	})
+	if err != nil && !isAWSErr(err, "CacheParameterGroupAlreadyExists", "") {
+		return fmt.Errorf("Error creating parameter group (%s): %s", name, err)
+	}
+
+	current, err := describeUserParameters(ctx, conn, name)
+	if err != nil {
+		return err
+	}
+	modify, reset := parameterChanges(current, expandParameters(d.Get("parameter").(*schema.Set).List()))
+
+	for i := 0; i < len(modify); i += parameterGroupBatchSize {
+		batch := modify[i:minInt(i+parameterGroupBatchSize, len(modify))]
+		log.Printf("[DEBUG] Modifying %d parameters of parameter group (%s)", len(batch), name)
+		_, err := conn.ModifyCacheParameterGroupWithContext(ctx, &elasticache.ModifyCacheParameterGroupInput{
+			CacheParameterGroupName: aws.String(name),
+			ParameterNameValues:     batch,
+		})
+		if err != nil {
+			return fmt.Errorf("Error modifying parameter group (%s): %s", name, err)
+		}
+	}
+
+	for i := 0; i < len(reset); i += parameterGroupBatchSize {
+		var batch []*elasticache.ParameterNameValue
+		for _, n := range reset[i:minInt(i+parameterGroupBatchSize, len(reset))] {
+			batch = append(batch, &elasticache.ParameterNameValue{ParameterName: aws.String(n)})
+		}
+		log.Printf("[DEBUG] Resetting %d parameters of parameter group (%s)", len(batch), name)
+		_, err := conn.ResetCacheParameterGroupWithContext(ctx, &elasticache.ResetCacheParameterGroupInput{
+			CacheParameterGroupName: aws.String(name),
+			ParameterNameValues:     batch,
+		})
+		if err != nil {
+			return fmt.Errorf("Error resetting parameters of parameter group (%s): %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// describeUserParameters returns the parameters set in the group
+// as opposed to the ones left at the family defaults.
+func describeUserParameters(ctx context.Context, conn *elasticache.ElastiCache, name string) (map[string]string, error) {
+	params := make(map[string]string)
+	err := conn.DescribeCacheParametersPagesWithContext(ctx, &elasticache.DescribeCacheParametersInput{
+		CacheParameterGroupName: aws.String(name),
+		Source:                  aws.String("user"),
+	}, func(page *elasticache.DescribeCacheParametersOutput, lastPage bool) bool {
+		for _, p := range page.Parameters {
+			params[aws.StringValue(p.ParameterName)] = aws.StringValue(p.ParameterValue)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error describing parameters of parameter group (%s): %s", name, err)
+	}
+	return params, nil
+}
+
+// updateReplicationGroupParameters is the update step that brings the
+// managed parameter group in line with the parameter blocks. The switch
+// of the replication group to it is left to updateReplicationGroupAttributes.
+func updateReplicationGroupParameters(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache) error {
+	if !d.HasChange("parameter") && !d.HasChange("engine_version") && !d.HasChange("engine") && !d.HasChange("parameter_group_name") {
+		return nil
+	}
+
+	if err := syncReplicationGroupParameters(ctx, d, conn); err != nil {
+		return err
+	}
+
+	// Otherwise committed by cleanUpManagedParameterGroup
+	// once the group has been switched over
+	if _, changed, err := replicationGroupParameterGroup(d); err != nil {
+		return err
+	} else if !changed {
+		d.SetPartial("parameter")
+	}
+	return nil
+}
+
+// cleanUpManagedParameterGroup is the update step that deletes the
+// managed parameter group the replication group has stopped using,
+// either because the parameter blocks are gone or after a major upgrade.
+func cleanUpManagedParameterGroup(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache, timeout time.Duration) error {
+	op, _ := d.GetChange("parameter")
+	oEngine, _ := d.GetChange("engine")
+	oVersion, _ := d.GetChange("engine_version")
+	if op.(*schema.Set).Len() > 0 {
+		managed, _, err := managedParameterGroup(d)
+		if err != nil {
+			return err
+		}
+		family, err := engineParameterGroupFamily(oEngine.(string), oVersion.(string))
+		if err != nil {
+			return err
+		}
+		if old := managedParameterGroupName(d.Get("replication_group_id").(string), family); old != managed {
+			if err := deleteManagedParameterGroup(ctx, conn, old, timeout); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.SetPartial("parameter")
+	return nil
+}
+
+// deleteManagedParameterGroup deletes the parameter group once nothing
+// uses it anymore. The members keep using it until the switch of the
+// replication group away from it has been applied.
+func deleteManagedParameterGroup(ctx context.Context, conn *elasticache.ElastiCache, name string, timeout time.Duration) error {
+	log.Printf("[INFO] Deleting parameter group (%s)", name)
+	err := retry(ctx, timeout, func() *resource.RetryError {
+		_, err := conn.DeleteCacheParameterGroupWithContext(ctx, &elasticache.DeleteCacheParameterGroupInput{
+			CacheParameterGroupName: aws.String(name),
+		})
+		switch {
+		case err == nil, isAWSErr(err, "CacheParameterGroupNotFound", ""):
+			return nil
+		case isAWSErr(err, "InvalidCacheParameterGroupState", ""):
+			log.Printf("[DEBUG] Parameter group (%s) is still in use: %s", name, err)
+			return resource.RetryableError(err)
+		}
+		return resource.NonRetryableError(err)
+	})
+	if err != nil {
+		return fmt.Errorf("Error deleting parameter group (%s): %s", name, err)
+	}
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,168 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestManagedParameterGroupName(t *testing.T) {
+	if name := managedParameterGroupName("Cache", "redis6.x"); name != "cache-redis6-x" {
+		t.Fatalf("unexpected name: %s", name)
+	}
+	if name := managedParameterGroupName("cache", "valkey8"); name != "cache-valkey8" {
+		t.Fatalf("unexpected name: %s", name)
+	}
+}
+
+func TestParameterChanges(t *testing.T) {
+	current := map[string]string{
+		"maxmemory-policy":       "allkeys-lru",
+		"notify-keyspace-events": "Ex",
+		"timeout":                "300",
+	}
+	configured := map[string]string{
+		"maxmemory-policy":       "volatile-lru",
+		"notify-keyspace-events": "Ex",
+		"activedefrag":           "yes",
+	}
+
+	modify, reset := parameterChanges(current, configured)
+
+	var modified []string
+	for _, p := range modify {
+		modified = append(modified, aws.StringValue(p.ParameterName)+"="+aws.StringValue(p.ParameterValue))
+	}
+	if expected := []string{"activedefrag=yes", "maxmemory-policy=volatile-lru"}; !reflect.DeepEqual(modified, expected) {
+		t.Fatalf("expected to modify %v, got %v", expected, modified)
+	}
+	if expected := []string{"timeout"}; !reflect.DeepEqual(reset, expected) {
+		t.Fatalf("expected to reset %v, got %v", expected, reset)
+	}
+
+	modify, reset = parameterChanges(configured, configured)
+	if len(modify) != 0 || len(reset) != 0 {
+		t.Fatalf("expected no changes, got %v and %v", modify, reset)
+	}
+}
+
+func TestDeleteManagedParameterGroup_inUse(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+		if n == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidCacheParameterGroupState</Code><Message>in use</Message></Error></ErrorResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<DeleteCacheParameterGroupResponse></DeleteCacheParameterGroupResponse>`)
+	}))
+	defer srv.Close()
+
+	if err := deleteManagedParameterGroup(context.Background(), testFakeElasticacheConn(srv.URL), "tf-test-redis7", time.Minute); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected the delete to be retried once, got %d attempts", attempts)
+	}
+}
+
+func TestResourceAwsElasticacheReplicationGroupCreate_parameterCleanup(t *testing.T) {
+	var mu sync.Mutex
+	var actions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		action := params.Get("Action")
+		mu.Lock()
+		actions = append(actions, action)
+		mu.Unlock()
+
+		switch action {
+		case "DescribeCacheParameterGroups":
+			fmt.Fprint(w, `<DescribeCacheParameterGroupsResponse><DescribeCacheParameterGroupsResult><CacheParameterGroups>
+  <CacheParameterGroup><CacheParameterGroupName>tf-test-redis7</CacheParameterGroupName><CacheParameterGroupFamily>redis7</CacheParameterGroupFamily></CacheParameterGroup>
+</CacheParameterGroups></DescribeCacheParameterGroupsResult></DescribeCacheParameterGroupsResponse>`)
+		case "CreateReplicationGroup":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InsufficientCacheClusterCapacity</Code><Message>no capacity</Message></Error></ErrorResponse>`)
+		default:
+			fmt.Fprintf(w, `<%sResponse></%sResponse>`, action, action)
+		}
+	}))
+	defer srv.Close()
+
+	raw, err := config.NewRawConfig(map[string]interface{}{
+		"replication_group_id": "tf-test",
+		"description":          "test",
+		"node_type":            "cache.m5.large",
+		"num_cache_clusters":   2,
+		"port":                 6379,
+		"engine":               "redis",
+		"engine_version":       "7.1",
+		"parameter": []interface{}{
+			map[string]interface{}{"name": "maxmemory-policy", "value": "allkeys-lru"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r := resourceAwsElasticacheReplicationGroup()
+	diff, err := r.Diff(nil, terraform.NewResourceConfig(raw))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	client := &AWSClient{elasticacheconn: testFakeElasticacheConn(srv.URL), stopCtx: context.Background()}
+	_, err = r.Apply(nil, diff, client)
+	if err == nil || !strings.Contains(err.Error(), "no capacity") {
+		t.Fatalf("expected the create error, got %v", err)
+	}
+
+	expected := []string{"CreateCacheParameterGroup", "CreateReplicationGroup", "DeleteCacheParameterGroup"}
+	var got []string
+	for _, a := range actions {
+		if strings.HasPrefix(a, "Create") || strings.HasPrefix(a, "Delete") {
+			got = append(got, a)
+		}
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestResourceAwsElasticacheReplicationGroup_parameterGroupConflict(t *testing.T) {
+	raw, err := config.NewRawConfig(map[string]interface{}{
+		"replication_group_id": "tf-test",
+		"description":          "test",
+		"port":                 6379,
+		"parameter_group_name": "default.redis7",
+		"parameter": []interface{}{
+			map[string]interface{}{"name": "maxmemory-policy", "value": "allkeys-lru"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, errs := resourceAwsElasticacheReplicationGroup().Validate(terraform.NewResourceConfig(raw))
+	if len(errs) == 0 {
+		t.Fatal("expected parameter_group_name to conflict with the parameter blocks")
+	}
+}
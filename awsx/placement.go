@@ -0,0 +1,424 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+type placementMember struct {
+	id, role, az string
+}
+
+// placementPlan moves members between availability zones by adding
+// a member to each of the add AZs and removing the members to remove,
+// getting back to the target number of members. The primary is failed over to
+// failoverAZ, or to any remaining replica if failoverAZ is empty,
+// when failover is set.
+type placementPlan struct {
+	add        []string
+	remove     []string
+	failover   bool
+	failoverAZ string
+}
+
+func (p placementPlan) empty() bool {
+	return len(p.add) == 0 && len(p.remove) == 0 && !p.failover
+}
+
+// planReplicationGroupPlacement makes as few moves as possible so that
+// no member is left outside of azs, every AZ of azs has a member as far
+// as the number of members allows and the primary is in primaryAZ.
+// Either of azs and primaryAZ may be empty.
+//
+// Members beyond size are the ones a rebalance that failed halfway
+// through has already added: they stand in for the adds of as many
+// moves, so that a rerun picks up where it failed rather than adding
+// more. A size of 0 takes the members as the target.
+func planReplicationGroupPlacement(members []placementMember, size int, azs []string, primaryAZ string) placementPlan {
+	var plan placementPlan
+
+	added := 0
+	if size > 0 && len(members) > size {
+		added = len(members) - size
+	}
+
+	allowed := make(map[string]bool, len(azs))
+	for _, az := range azs {
+		allowed[az] = true
+	}
+	counts := make(map[string]int, len(azs))
+
+	var primary *placementMember
+	var movers, staying []placementMember
+	for i, m := range members {
+		if m.role == "primary" {
+			primary = &members[i]
+		}
+		if len(azs) > 0 && !allowed[m.az] {
+			movers = append(movers, m)
+			continue
+		}
+		staying = append(staying, m)
+		counts[m.az]++
+	}
+
+	// Added members left over once the moves are accounted for were
+	// added to cover an AZ, the replicas they replace are in crowded ones.
+	sort.Slice(staying, func(i, j int) bool { return staying[i].id > staying[j].id })
+	for added > len(movers) {
+		surplus := -1
+		for i, m := range staying {
+			if m.role != "primary" && (surplus < 0 || counts[m.az] > counts[staying[surplus].az]) {
+				surplus = i
+			}
+		}
+		if surplus < 0 {
+			break
+		}
+		counts[staying[surplus].az]--
+		plan.remove = append(plan.remove, staying[surplus].id)
+		staying = append(staying[:surplus], staying[surplus+1:]...)
+		added--
+	}
+
+	sortedAZs := append([]string(nil), azs...)
+	sort.Strings(sortedAZs)
+	var uncovered []string
+	for _, az := range sortedAZs {
+		if counts[az] == 0 {
+			uncovered = append(uncovered, az)
+		}
+	}
+
+	// Replicas from crowded AZs cover the AZs nobody moves to
+	for len(uncovered) > len(movers)-added {
+		donor := -1
+		for i, m := range staying {
+			if m.role != "primary" && counts[m.az] > 1 && (donor < 0 || counts[m.az] > counts[staying[donor].az]) {
+				donor = i
+			}
+		}
+		if donor < 0 {
+			break
+		}
+		counts[staying[donor].az]--
+		movers = append(movers, staying[donor])
+		staying = append(staying[:donor], staying[donor+1:]...)
+	}
+
+	// A member has to move to primaryAZ for the primary to fail over
+	// to, the primary itself if nobody else is moving anyway.
+	if primary != nil && primaryAZ != "" && primary.az != primaryAZ && counts[primaryAZ] == 0 {
+		if len(movers) == added {
+			movers = append(movers, *primary)
+			counts[primary.az]--
+		}
+		uncovered = append([]string{primaryAZ}, removeString(uncovered, primaryAZ)...)
+	}
+
+	primaryMoves := false
+	sort.Slice(movers, func(i, j int) bool { return movers[i].id < movers[j].id })
+	for i, m := range movers {
+		primaryMoves = primaryMoves || (primary != nil && m.id == primary.id)
+		if i < added {
+			plan.remove = append(plan.remove, m.id)
+			continue
+		}
+
+		var target string
+		switch {
+		case len(uncovered) > 0:
+			target, uncovered = uncovered[0], uncovered[1:]
+		case len(sortedAZs) > 0:
+			for _, az := range sortedAZs {
+				if target == "" || counts[az] < counts[target] {
+					target = az
+				}
+			}
+		default:
+			target = m.az
+		}
+		counts[target]++
+		plan.add = append(plan.add, target)
+		plan.remove = append(plan.remove, m.id)
+	}
+
+	if primary != nil && primaryAZ != "" && primary.az != primaryAZ {
+		plan.failover, plan.failoverAZ = true, primaryAZ
+	} else if primaryMoves {
+		plan.failover = true
+	}
+	return plan
+}
+
+func removeString(list []string, s string) []string {
+	for i, v := range list {
+		if v == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// nextMemberClusterID continues the <group id>-NNN numbering
+// ElastiCache uses for the member clusters it creates.
+func nextMemberClusterID(replGroupID string, existing []string) string {
+	max := 0
+	for _, id := range existing {
+		if n, err := strconv.Atoi(strings.TrimPrefix(id, replGroupID+"-")); err == nil && n > max {
+			max = n
+		}
+	}
+	return fmt.Sprintf("%s-%03d", replGroupID, max+1)
+}
+
+// updateReplicationGroupPlacement is the update step that rebalances
+// the members over availability_zones and primary_availability_zone.
+func updateReplicationGroupPlacement(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache, timeout time.Duration) error {
+	if !d.HasChange("availability_zones") && !d.HasChange("primary_availability_zone") {
+		return nil
+	}
+
+	if err := rebalanceReplicationGroup(ctx, d, conn, timeout); err != nil {
+		return err
+	}
+
+	d.SetPartial("availability_zones")
+	d.SetPartial("primary_availability_zone")
+	return nil
+}
+
+// rebalanceReplicationGroup moves the members in place: the new members
+// are added first, then the primary fails over and only then the old
+// members are removed, so that the group keeps its replicas throughout.
+// The timeout covers the whole of it.
+func rebalanceReplicationGroup(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	azs := expandStringList(d.Get("availability_zones").(*schema.Set).List())
+	primaryAZ := d.Get("primary_availability_zone").(string)
+	if primaryAZ != "" && len(azs) > 0 && !stringInSlice(primaryAZ, aws.StringValueSlice(azs)) {
+		return fmt.Errorf("primary_availability_zone %q has to be one of availability_zones", primaryAZ)
+	}
+
+	members, err := replicationGroupPlacement(ctx, conn, d.Id())
+	if err != nil {
+		return err
+	}
+	plan := planReplicationGroupPlacement(members, d.Get("num_cache_clusters").(int), aws.StringValueSlice(azs), primaryAZ)
+	if plan.empty() {
+		return nil
+	}
+	log.Printf("[INFO] Rebalancing ElastiCache Replication Group (%s): adding members in %v, removing %v, failover: %t",
+		d.Id(), plan.add, plan.remove, plan.failover)
+
+	if err := waitForReplicationGroupOperationInProgress(ctx, conn, d.Id(), time.Until(deadline)); err != nil {
+		return err
+	}
+
+	existing := make([]string, 0, len(members))
+	for _, m := range members {
+		existing = append(existing, m.id)
+	}
+	for _, az := range plan.add {
+		id := nextMemberClusterID(d.Id(), existing)
+		existing = append(existing, id)
+		if err := addReplicationGroupMember(ctx, conn, d.Id(), id, az, time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+
+	if plan.failover {
+		members, err := replicationGroupPlacement(ctx, conn, d.Id())
+		if err != nil {
+			return err
+		}
+		var target string
+		for _, m := range members {
+			if m.role != "primary" && !stringInSlice(m.id, plan.remove) && (plan.failoverAZ == "" || m.az == plan.failoverAZ) {
+				target = m.id
+				break
+			}
+		}
+		if target == "" {
+			return fmt.Errorf("Error rebalancing elasticache (%s): no replica to fail over to in %q", d.Id(), plan.failoverAZ)
+		}
+
+		if err := failoverReplicationGroup(ctx, conn, d.Id(), target, time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range plan.remove {
+		if err := removeReplicationGroupMember(ctx, conn, d.Id(), id, time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+
+	return waitForReplicationGroupOperationInProgress(ctx, conn, d.Id(), time.Until(deadline))
+}
+
+// failoverRequests returns the modifications that promote target to the
+// primary. ElastiCache refuses PrimaryClusterId while automatic failover
+// is on, so it is turned off before the promotion, along with Multi-AZ
+// that depends on it, and turned back on after; disable and enable are
+// nil if it is off.
+func failoverRequests(rg *elasticache.ReplicationGroup, target string) (disable, promote, enable *elasticache.ModifyReplicationGroupInput) {
+	promote = &elasticache.ModifyReplicationGroupInput{
+		ReplicationGroupId: rg.ReplicationGroupId,
+		PrimaryClusterId:   aws.String(target),
+		ApplyImmediately:   aws.Bool(true),
+	}
+
+	switch aws.StringValue(rg.AutomaticFailover) {
+	case elasticache.AutomaticFailoverStatusEnabled, elasticache.AutomaticFailoverStatusEnabling:
+	default:
+		return nil, promote, nil
+	}
+
+	disable = &elasticache.ModifyReplicationGroupInput{
+		ReplicationGroupId:       rg.ReplicationGroupId,
+		AutomaticFailoverEnabled: aws.Bool(false),
+		ApplyImmediately:         aws.Bool(true),
+	}
+	enable = &elasticache.ModifyReplicationGroupInput{
+		ReplicationGroupId:       rg.ReplicationGroupId,
+		AutomaticFailoverEnabled: aws.Bool(true),
+		ApplyImmediately:         aws.Bool(true),
+	}
+	if aws.StringValue(rg.MultiAZ) == elasticache.MultiAZStatusEnabled {
+		disable.MultiAZEnabled = aws.Bool(false)
+		enable.MultiAZEnabled = aws.Bool(true)
+	}
+	return disable, promote, enable
+}
+
+// failoverReplicationGroup promotes target to the primary as laid out by
+// failoverRequests. Automatic failover is turned back on even if the
+// promotion fails.
+func failoverReplicationGroup(ctx context.Context, conn *elasticache.ElastiCache, replGroupID, target string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	rg, err := describeReplicationGroup(ctx, conn, replGroupID)
+	if err != nil {
+		return err
+	}
+	if rg == nil {
+		return fmt.Errorf("ElastiCache Replication Group (%s) not found", replGroupID)
+	}
+
+	log.Printf("[INFO] Failing ElastiCache Replication Group (%s) over to %s", replGroupID, target)
+	disable, promote, enable := failoverRequests(rg, target)
+	if disable != nil {
+		log.Printf("[DEBUG] Turning off automatic failover of ElastiCache Replication Group (%s) for the failover", replGroupID)
+		if err := modifyReplicationGroupAndWait(ctx, conn, disable, "", time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+
+	err = modifyReplicationGroupAndWait(ctx, conn, promote, "", time.Until(deadline))
+
+	if enable != nil {
+		log.Printf("[DEBUG] Turning automatic failover of ElastiCache Replication Group (%s) back on", replGroupID)
+		if eerr := modifyReplicationGroupAndWait(ctx, conn, enable, "", time.Until(deadline)); eerr != nil {
+			if err != nil {
+				return fmt.Errorf("%s; automatic failover is left off: %s", err, eerr)
+			}
+			return eerr
+		}
+	}
+	return err
+}
+
+// replicationGroupPlacement lists the members with their roles and AZs.
+func replicationGroupPlacement(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string) ([]placementMember, error) {
+	rg, err := describeReplicationGroup(ctx, conn, replGroupID)
+	if err != nil {
+		return nil, err
+	}
+	if rg == nil || len(rg.NodeGroups) != 1 {
+		return nil, fmt.Errorf("ElastiCache Replication Group (%s) not found", replGroupID)
+	}
+
+	var members []placementMember
+	for _, m := range rg.NodeGroups[0].NodeGroupMembers {
+		members = append(members, placementMember{
+			id:   aws.StringValue(m.CacheClusterId),
+			role: aws.StringValue(m.CurrentRole),
+			az:   aws.StringValue(m.PreferredAvailabilityZone),
+		})
+	}
+	return members, nil
+}
+
+func addReplicationGroupMember(ctx context.Context, conn *elasticache.ElastiCache, replGroupID, clusterID, az string, timeout time.Duration) error {
+	log.Printf("[INFO] Adding member (%s) in %s to ElastiCache Replication Group (%s)", clusterID, az, replGroupID)
+	deadline := time.Now().Add(timeout)
+	err := retryWhileReplicationGroupBusy(ctx, conn, replGroupID, deadline, func() error {
+		_, err := conn.CreateCacheClusterWithContext(ctx, &elasticache.CreateCacheClusterInput{
+			CacheClusterId:            aws.String(clusterID),
+			ReplicationGroupId:        aws.String(replGroupID),
+			PreferredAvailabilityZone: aws.String(az),
+		})
+		if isAWSErr(err, "CacheClusterAlreadyExists", "") {
+			// An interrupted rebalance has added it already
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Error adding member (%s) to elasticache (%s): %s", clusterID, replGroupID, err)
+	}
+
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{"creating", "modifying"},
+		Target:     []string{"available"},
+		Refresh:    cacheClusterStateRefreshFunc(ctx, conn, clusterID),
+		Timeout:    time.Until(deadline),
+		Delay:      10 * time.Second,
+		MinTimeout: 3 * time.Second,
+	}
+	if _, err := waitForState(ctx, stateConf, "the cache cluster"); err != nil {
+		return fmt.Errorf("Error waiting for member (%s) of elasticache (%s) to become available: %s", clusterID, replGroupID, err)
+	}
+	return nil
+}
+
+func removeReplicationGroupMember(ctx context.Context, conn *elasticache.ElastiCache, replGroupID, clusterID string, timeout time.Duration) error {
+	log.Printf("[INFO] Removing member (%s) from ElastiCache Replication Group (%s)", clusterID, replGroupID)
+	deadline := time.Now().Add(timeout)
+	err := retryWhileReplicationGroupBusy(ctx, conn, replGroupID, deadline, func() error {
+		_, err := conn.DeleteCacheClusterWithContext(ctx, &elasticache.DeleteCacheClusterInput{
+			CacheClusterId: aws.String(clusterID),
+		})
+		if isAWSErr(err, "CacheClusterNotFound", "") {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Error removing member (%s) from elasticache (%s): %s", clusterID, replGroupID, err)
+	}
+
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{"available", "deleting", "modifying"},
+		Target:     []string{},
+		Refresh:    cacheClusterStateRefreshFunc(ctx, conn, clusterID),
+		Timeout:    time.Until(deadline),
+		Delay:      10 * time.Second,
+		MinTimeout: 3 * time.Second,
+	}
+	if _, err := waitForState(ctx, stateConf, "the cache cluster"); err != nil {
+		return fmt.Errorf("Error waiting for member (%s) of elasticache (%s) to be removed: %s", clusterID, replGroupID, err)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package awsx
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+func TestPlanReplicationGroupPlacement(t *testing.T) {
+	cases := []struct {
+		name      string
+		members   []placementMember
+		size      int
+		azs       []string
+		primaryAZ string
+		expected  placementPlan
+	}{
+		{
+			name: "balanced",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+			},
+			azs:      []string{"a", "b"},
+			expected: placementPlan{},
+		},
+		{
+			name: "no availability zones",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "a"},
+			},
+			expected: placementPlan{},
+		},
+		{
+			name: "replica outside of the zones",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+			},
+			azs: []string{"a", "c"},
+			expected: placementPlan{
+				add:    []string{"c"},
+				remove: []string{"rg-002"},
+			},
+		},
+		{
+			name: "primary outside of the zones",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+			},
+			azs: []string{"b", "c"},
+			expected: placementPlan{
+				add:      []string{"c"},
+				remove:   []string{"rg-001"},
+				failover: true,
+			},
+		},
+		{
+			name: "uncovered zone",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "a"},
+				{"rg-003", "replica", "a"},
+			},
+			azs: []string{"a", "b"},
+			expected: placementPlan{
+				add:    []string{"b"},
+				remove: []string{"rg-003"},
+			},
+		},
+		{
+			name: "more zones than members",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+			},
+			azs:      []string{"a", "b", "c"},
+			expected: placementPlan{},
+		},
+		{
+			name: "primary pinned to a replica's zone",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+			},
+			azs:       []string{"a", "b"},
+			primaryAZ: "b",
+			expected: placementPlan{
+				failover:   true,
+				failoverAZ: "b",
+			},
+		},
+		{
+			name: "primary pinned to an empty zone",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+			},
+			primaryAZ: "c",
+			expected: placementPlan{
+				add:        []string{"c"},
+				remove:     []string{"rg-001"},
+				failover:   true,
+				failoverAZ: "c",
+			},
+		},
+		{
+			name: "primary pinned to the zone a replica moves to",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+				{"rg-003", "replica", "d"},
+			},
+			azs:       []string{"a", "b", "c"},
+			primaryAZ: "c",
+			expected: placementPlan{
+				add:        []string{"c"},
+				remove:     []string{"rg-003"},
+				failover:   true,
+				failoverAZ: "c",
+			},
+		},
+		{
+			name: "half-applied move out of a zone",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+				{"rg-003", "replica", "c"},
+			},
+			size: 2,
+			azs:  []string{"a", "c"},
+			expected: placementPlan{
+				remove: []string{"rg-002"},
+			},
+		},
+		{
+			name: "half-applied move of the primary",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+				{"rg-003", "replica", "c"},
+			},
+			size: 2,
+			azs:  []string{"b", "c"},
+			expected: placementPlan{
+				remove:   []string{"rg-001"},
+				failover: true,
+			},
+		},
+		{
+			name: "half-applied cover of a zone",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "a"},
+				{"rg-003", "replica", "a"},
+				{"rg-004", "replica", "b"},
+			},
+			size: 3,
+			azs:  []string{"a", "b"},
+			expected: placementPlan{
+				remove: []string{"rg-003"},
+			},
+		},
+		{
+			name: "half-applied move with another one to go",
+			members: []placementMember{
+				{"rg-001", "primary", "a"},
+				{"rg-002", "replica", "b"},
+				{"rg-003", "replica", "b"},
+				{"rg-004", "replica", "c"},
+			},
+			size: 3,
+			azs:  []string{"a", "c", "d"},
+			expected: placementPlan{
+				add:    []string{"d"},
+				remove: []string{"rg-002", "rg-003"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		plan := planReplicationGroupPlacement(c.members, c.size, c.azs, c.primaryAZ)
+		if !reflect.DeepEqual(plan, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.expected, plan)
+		}
+	}
+}
+
+func TestNextMemberClusterID(t *testing.T) {
+	existing := []string{"rg-001", "rg-003", "rg-custom", "other-009"}
+	if id := nextMemberClusterID("rg", existing); id != "rg-004" {
+		t.Fatalf("expected rg-004, got %s", id)
+	}
+	if id := nextMemberClusterID("rg", nil); id != "rg-001" {
+		t.Fatalf("expected rg-001, got %s", id)
+	}
+}
+
+func TestFailoverRequests(t *testing.T) {
+	cases := []struct {
+		automaticFailover, multiAZ string
+		disable, enable            string
+	}{
+		{"disabled", "disabled", "", ""},
+		{"enabled", "disabled", "false <nil>", "true <nil>"},
+		{"enabled", "enabled", "false false", "true true"},
+		{"enabling", "enabled", "false false", "true true"},
+	}
+
+	flags := func(req *elasticache.ModifyReplicationGroupInput) string {
+		if req == nil {
+			return ""
+		}
+		if req.PrimaryClusterId != nil {
+			return "unexpected PrimaryClusterId"
+		}
+		s := fmt.Sprint(aws.BoolValue(req.AutomaticFailoverEnabled), " ")
+		if req.MultiAZEnabled == nil {
+			return s + "<nil>"
+		}
+		return s + fmt.Sprint(*req.MultiAZEnabled)
+	}
+
+	for i, c := range cases {
+		rg := &elasticache.ReplicationGroup{
+			ReplicationGroupId: aws.String("tf-test"),
+			AutomaticFailover:  aws.String(c.automaticFailover),
+			MultiAZ:            aws.String(c.multiAZ),
+		}
+		disable, promote, enable := failoverRequests(rg, "tf-test-002")
+		if aws.StringValue(promote.PrimaryClusterId) != "tf-test-002" || promote.AutomaticFailoverEnabled != nil {
+			t.Fatalf("%d: unexpected promotion: %s", i, promote)
+		}
+		if s := flags(disable); s != c.disable {
+			t.Fatalf("%d: expected disable %q, got %q", i, c.disable, s)
+		}
+		if s := flags(enable); s != c.enable {
+			t.Fatalf("%d: expected enable %q, got %q", i, c.enable, s)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package awsx
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,11 +16,12 @@ import (
 
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/hashicorp/terraform/terraform"
 )
 
 func Provider() terraform.ResourceProvider {
-	return &schema.Provider{
+	provider := &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"access_key": &schema.Schema{
 				Type:        schema.TypeString,
@@ -70,13 +75,25 @@ func Provider() terraform.ResourceProvider {
 				Default:     11,
 				Description: descriptions["max_retries"],
 			},
+
+			"describe_cache": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: descriptions["describe_cache"],
+			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
 			"awsx_elasticache_replication_group": resourceAwsElasticacheReplicationGroup(),
 		},
-		ConfigureFunc: providerConfigure,
 	}
+
+	provider.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
+		return providerConfigure(d, provider.StopContext())
+	}
+
+	return newReplacingProvider(provider)
 }
 
 func resourceAwsElasticacheReplicationGroup() *schema.Resource {
@@ -86,6 +103,12 @@ func resourceAwsElasticacheReplicationGroup() *schema.Resource {
 		Update: resourceAwsElasticacheReplictaionGroupUpdate,
 		Delete: resourceAwsElasticacheReplictaionGroupDelete,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			// TODO cluster_id
 			"replication_group_id": &schema.Schema{
@@ -105,9 +128,11 @@ func resourceAwsElasticacheReplicationGroup() *schema.Resource {
 				Default:  "",
 				Optional: true,
 			},
+			// Required unless the group joins a Global Datastore
 			"node_type": &schema.Schema{
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+				Computed: true,
 			},
 			"num_cache_clusters": &schema.Schema{
 				Type:     schema.TypeInt,
@@ -115,20 +140,64 @@ func resourceAwsElasticacheReplicationGroup() *schema.Resource {
 				ForceNew: true,
 			},
 			"parameter_group_name": &schema.Schema{
-				Type:     schema.TypeString,
-				Optional: true,
-				Computed: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"parameter"},
+			},
+			// Kept in a parameter group the provider creates and
+			// attaches instead of parameter_group_name, see parameters.go
+			"parameter": &schema.Schema{
+				Type:          schema.TypeSet,
+				Optional:      true,
+				ConflictsWith: []string{"parameter_group_name"},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"value": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+						},
+					},
+				},
 			},
+			// Changing port, subnet_group_name or security_group_names
+			// replaces the group as replacement_strategy says, see
+			// replacingProvider.
 			"port": &schema.Schema{
 				Type:     schema.TypeInt,
 				Required: true,
 				ForceNew: true,
 			},
+			// Upgrading from redis to valkey happens in place,
+			// the other way around isn't supported by ElastiCache.
+			// Defaults to redis unless the group joins a Global Datastore
+			"engine": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"redis", "valkey"}, false),
+			},
 			"engine_version": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
 				Computed: true,
 			},
+			"auto_minor_version_upgrade": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			// Makes a major engine_version change snapshot the group and
+			// move it to the new parameter group family, see upgrade.go
+			"orchestrate_major_version_upgrade": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
 			"maintenance_window": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
@@ -169,6 +238,9 @@ func resourceAwsElasticacheReplicationGroup() *schema.Resource {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			// ElastiCache reports hostnames only, also for IPv6 and dual
+			// stack groups: their records resolve to the addresses of
+			// the ip_discovery family, AAAA for "ipv6".
 			"endpoint": &schema.Schema{
 				Type:     schema.TypeMap,
 				Computed: true,
@@ -185,6 +257,7 @@ func resourceAwsElasticacheReplicationGroup() *schema.Resource {
 					},
 				},
 			},
+			// Addresses are hostnames as for endpoint
 			"cache_nodes": &schema.Schema{
 				Type:     schema.TypeList,
 				Computed: true,
@@ -210,9 +283,48 @@ func resourceAwsElasticacheReplicationGroup() *schema.Resource {
 							Type:     schema.TypeString,
 							Computed: true,
 						},
+						"parameter_apply_status": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
 					},
 				},
 			},
+			"transit_encryption_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+			// Changes in place go through preferred, see transit_encryption.go
+			"transit_encryption_mode": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ValidateFunc: validation.StringInSlice([]string{
+					elasticache.TransitEncryptionModePreferred,
+					elasticache.TransitEncryptionModeRequired,
+				}, false),
+			},
+			"network_type": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+				ValidateFunc: validation.StringInSlice([]string{
+					elasticache.NetworkTypeIpv4,
+					elasticache.NetworkTypeIpv6,
+					elasticache.NetworkTypeDualStack,
+				}, false),
+			},
+			"ip_discovery": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ValidateFunc: validation.StringInSlice([]string{
+					elasticache.IpDiscoveryIpv4,
+					elasticache.IpDiscoveryIpv6,
+				}, false),
+			},
 			"notification_topic_arn": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
@@ -247,6 +359,13 @@ func resourceAwsElasticacheReplicationGroup() *schema.Resource {
 				},
 			},
 
+			// When not set, the snapshotting cluster is chosen
+			// automatically, see autoSnapshottingCluster.
+			"snapshotting_cluster_id": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
 			"automatic_failover": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
@@ -260,14 +379,99 @@ func resourceAwsElasticacheReplicationGroup() *schema.Resource {
 				},
 			},
 
+			// Requires automatic_failover and replicas in at least two AZs
+			"multi_az_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+
+			// Changing it moves the members in place, see
+			// rebalanceReplicationGroup.
 			"availability_zones": &schema.Schema{
 				Type:     schema.TypeSet,
 				Optional: true,
-				ForceNew: true,
 				Elem:     &schema.Schema{Type: schema.TypeString},
 				Set:      schema.HashString,
 			},
 
+			// The AZ the primary is kept in, failing over when it changes.
+			"primary_availability_zone": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+
+			// Joins the group to an existing Global Datastore as a secondary.
+			// Removing it detaches the group, joining later isn't supported.
+			// Left empty for a primary, see global_replication_group_member_of.
+			"global_replication_group_id": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			// The Global Datastore the group is a member of in any role
+			"global_replication_group_member_of": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"global_replication_group_role": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"log_delivery_configuration": logDeliveryConfigurationSchema(),
+
+			// Summed up over the members, see replicationGroupParameterApplyStatus
+			"parameter_apply_status": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			// Reboots the members with parameters pending a reboot on
+			// update, one at a time with the primary last. Only an update
+			// triggers it, parameter_apply_status causes no diff.
+			"reboot_on_parameter_change": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			// Client-side only: waits for the endpoint to answer and the
+			// replicas to sync after the group is created or updated.
+			"wait_for_ready": waitForReadySchema(),
+
+			// RBAC user groups that control access to the group
+			"user_group_ids": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+
+			// What to do with a group that ended up in create-failed:
+			// "keep" it tainted, "delete" it or delete it and "retry" once.
+			"on_create_failure": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "keep",
+				ValidateFunc: validation.StringInSlice([]string{"keep", "delete", "retry"}, false),
+			},
+
+			// Client-side only: while enabled, the provider refuses
+			// to delete the group, including replacements.
+			"deletion_protection": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			// Client-side only: whether a change that ElastiCache can't
+			// apply in place fails or replaces the group, see replace.go
+			"replacement_strategy": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "recreate",
+				ValidateFunc: validation.StringInSlice([]string{"recreate", "blue_green"}, false),
+			},
+
 			//"tags": tagsSchema(), TODO
 
 			"apply_immediately": &schema.Schema{
@@ -304,17 +508,58 @@ func init() {
 		"max_retries": "The maximum number of times an AWS API request is\n" +
 			"being executed. If the API request still fails, an error is\n" +
 			"thrown.",
+
+		"describe_cache": "Describe all replication groups and cache clusters\n" +
+			"in a single sweep and serve refreshes from it. Speeds up\n" +
+			"workspaces with many replication groups.",
 	}
 }
 
 func resourceAwsElasticacheReplictaionGroupCreate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*elasticache.ElastiCache)
+	client := meta.(*AWSClient)
+	conn := client.elasticacheconn
+	ctx := client.stopCtx
 
 	replicationGroupId := d.Get("replication_group_id").(string)
+	client.describeCache.invalidate(replicationGroupId)
+
+	var req *elasticache.CreateReplicationGroupInput
+	err := syncReplicationGroupParameters(ctx, d, conn)
+	if err == nil {
+		req, err = replicationGroupCreateInput(ctx, d, conn, replicationGroupId)
+	}
+	if err == nil {
+		err = createReplicationGroupOnFailure(ctx, d, conn, req, d.Timeout(schema.TimeoutCreate))
+	}
+	if err != nil {
+		// Nothing uses the managed parameter group unless a group is left
+		if d.Id() == "" {
+			if name, _, nerr := managedParameterGroup(d); nerr == nil && name != "" {
+				if derr := deleteManagedParameterGroup(ctx, conn, name, d.Timeout(schema.TimeoutDelete)); derr != nil {
+					log.Printf("[WARN] Error cleaning up after the failed create of elasticache (%s): %s", replicationGroupId, derr)
+				}
+			}
+		}
+		return err
+	}
+	if err := configureCreatedReplicationGroup(ctx, d, conn, req, d.Timeout(schema.TimeoutCreate)); err != nil {
+		return err
+	}
+
+	if err := resourceAwsElasticacheReplictaionGroupRead(d, meta); err != nil {
+		return err
+	}
+	return waitForReplicationGroupReady(ctx, d)
+}
+
+// replicationGroupCreateInput builds the request creating
+// the configured replication group under replGroupID.
+func replicationGroupCreateInput(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache, replGroupID string) (*elasticache.CreateReplicationGroupInput, error) {
 	description := d.Get("description").(string)
 	nodeType := d.Get("node_type").(string) // e.g) cache.m1.small
 	// TODO either cluster_id or num_cache_clusters > 1
 	numNodes := int64(d.Get("num_cache_clusters").(int)) // 2
+	engine := d.Get("engine").(string)                   // redis or valkey
 	engineVersion := d.Get("engine_version").(string)    // 1.4.14
 	port := int64(d.Get("port").(int))                   // e.g) 11211
 	subnetGroupName := d.Get("subnet_group_name").(string)
@@ -325,21 +570,47 @@ func resourceAwsElasticacheReplictaionGroupCreate(d *schema.ResourceData, meta i
 	securityIds := expandStringList(securityIdSet.List())
 
 	req := &elasticache.CreateReplicationGroupInput{
-		ReplicationGroupId:          aws.String(replicationGroupId),
+		ReplicationGroupId:          aws.String(replGroupID),
 		ReplicationGroupDescription: aws.String(description),
-		CacheNodeType:               aws.String(nodeType),
 		NumCacheClusters:            aws.Int64(numNodes),
-		Engine:                      aws.String("redis"),
-		EngineVersion:               aws.String(engineVersion),
 		Port:                        aws.Int64(port),
 		CacheSubnetGroupName:        aws.String(subnetGroupName),
 		CacheSecurityGroupNames:     securityNames,
 		SecurityGroupIds:            securityIds,
+		AutoMinorVersionUpgrade:     aws.Bool(d.Get("auto_minor_version_upgrade").(bool)),
 	}
 
-	// parameter groups are optional and can be defaulted by AWS
-	if v, ok := d.GetOk("parameter_group_name"); ok {
-		req.CacheParameterGroupName = aws.String(v.(string))
+	if v, ok := d.GetOk("global_replication_group_id"); ok {
+		// A secondary inherits all of these from the Global Datastore
+		for _, k := range []string{"node_type", "engine", "engine_version", "parameter_group_name", "parameter"} {
+			if _, ok := d.GetOk(k); ok {
+				return nil, fmt.Errorf("%q can't be configured for a member of Global Datastore (%s), it is inherited", k, v)
+			}
+		}
+		req.GlobalReplicationGroupId = aws.String(v.(string))
+	} else {
+		if nodeType == "" {
+			return nil, fmt.Errorf("node_type is required unless global_replication_group_id is set")
+		}
+		if engine == "" {
+			engine = "redis"
+		}
+		req.CacheNodeType = aws.String(nodeType)
+		req.Engine = aws.String(engine)
+		req.EngineVersion = aws.String(engineVersion)
+
+		// parameter groups are optional and can be defaulted by AWS
+		parameterGroupName, _, err := replicationGroupParameterGroup(d)
+		if err != nil {
+			return nil, err
+		}
+		if parameterGroupName != "" {
+			req.CacheParameterGroupName = aws.String(parameterGroupName)
+		}
+
+		if err := validateEngineConfiguration(ctx, conn, engine, engineVersion, aws.StringValue(req.CacheParameterGroupName)); err != nil {
+			return nil, err
+		}
 	}
 
 	if v, ok := d.GetOk("snapshot_retention_limit"); ok {
@@ -375,8 +646,162 @@ func resourceAwsElasticacheReplictaionGroupCreate(d *schema.ResourceData, meta i
 		req.PreferredCacheClusterAZs = azs
 	}
 
-	resp, err := conn.CreateReplicationGroup(req)
+	if v, ok := d.GetOk("network_type"); ok {
+		req.NetworkType = aws.String(v.(string))
+	}
+
+	if v, ok := d.GetOk("ip_discovery"); ok {
+		req.IpDiscovery = aws.String(v.(string))
+	}
+
+	err := validateReplicationGroupNetwork(ctx, conn, subnetGroupName,
+		aws.StringValue(req.NetworkType), aws.StringValue(req.IpDiscovery))
 	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := d.GetOk("multi_az_enabled"); ok {
+		if err := validateReplicationGroupMultiAZ(d); err != nil {
+			return nil, err
+		}
+		req.MultiAZEnabled = aws.Bool(v.(bool))
+	}
+
+	if v := d.Get("log_delivery_configuration").(*schema.Set); v.Len() > 0 {
+		configs, err := expandLogDeliveryConfigurations(v.List())
+		if err != nil {
+			return nil, err
+		}
+		req.LogDeliveryConfigurations = configs
+	}
+
+	if v := d.Get("user_group_ids").(*schema.Set); v.Len() > 0 {
+		req.UserGroupIds = expandStringList(v.List())
+	}
+
+	if d.Get("transit_encryption_enabled").(bool) {
+		req.TransitEncryptionEnabled = aws.Bool(true)
+		if v, ok := d.GetOk("transit_encryption_mode"); ok {
+			req.TransitEncryptionMode = aws.String(v.(string))
+		}
+	} else if v, ok := d.GetOk("transit_encryption_mode"); ok {
+		return nil, fmt.Errorf("transit_encryption_mode %q requires transit_encryption_enabled", v)
+	}
+
+	req.Tags = []*elasticache.Tag{{
+		Key:   aws.String(replicationGroupCreateTokenTag),
+		Value: aws.String(replicationGroupCreateToken(req)),
+	}}
+
+	return req, nil
+}
+
+// The tag the create request is marked with, so that a group left behind
+// by an interrupted create can be recognized as one, see
+// interruptedReplicationGroupCreation.
+const replicationGroupCreateTokenTag = "terraform-awsx-create-token"
+
+// replicationGroupCreateToken identifies the create request by its
+// content, so that it comes out the same in the apply that resumes an
+// interrupted one and differs for anything else creating the same id.
+func replicationGroupCreateToken(req *elasticache.CreateReplicationGroupInput) string {
+	r := *req
+	r.Tags = nil
+	sum := sha256.Sum256([]byte(r.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// createReplicationGroupOnFailure creates the replication group
+// handling a failed creation as on_create_failure says.
+func createReplicationGroupOnFailure(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache, req *elasticache.CreateReplicationGroupInput, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	onFailure := d.Get("on_create_failure").(string)
+	for attempt := 1; ; attempt++ {
+		err := createReplicationGroup(ctx, d, conn, req, time.Until(deadline))
+		if err == nil {
+			break
+		}
+		if onFailure == "keep" || d.Id() == "" {
+			return err
+		}
+
+		rg, derr := describeReplicationGroup(ctx, conn, d.Id())
+		if derr != nil || rg == nil {
+			return err
+		}
+		remove, retry := onCreateFailureAction(onFailure, attempt, *rg.Status)
+		if !remove {
+			return err
+		}
+
+		log.Printf("[WARN] ElastiCache Replication Group (%s) failed to create, deleting it", d.Id())
+		if derr := deleteFailedReplicationGroup(ctx, conn, rg, d.Timeout(schema.TimeoutDelete)); derr != nil {
+			return fmt.Errorf("%s\nError deleting the failed replication group: %s", err, derr)
+		}
+		d.SetId("")
+
+		if !retry {
+			return err
+		}
+		log.Printf("[INFO] Retrying creation of ElastiCache Replication Group (%s)", *req.ReplicationGroupId)
+	}
+
+	return nil
+}
+
+// onCreateFailureAction decides what on_create_failure does about a group
+// in the given status after the attempt to create it has failed: whether
+// the group is deleted and whether the creation is tried again. Only a
+// group in create-failed is ever deleted and there is a single retry.
+func onCreateFailureAction(onFailure string, attempt int, status string) (remove, retry bool) {
+	if onFailure == "keep" || status != "create-failed" {
+		return false, false
+	}
+	return true, onFailure == "retry" && attempt == 1
+}
+
+// configureCreatedReplicationGroup applies the settings
+// that can only be applied once the group exists.
+func configureCreatedReplicationGroup(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache, req *elasticache.CreateReplicationGroupInput, timeout time.Duration) error {
+	userGroupIds := aws.StringValueSlice(req.UserGroupIds)
+	if err := waitForUserGroupAssociations(ctx, conn, d.Id(), userGroupIds, nil, timeout); err != nil {
+		return err
+	}
+
+	// Member clusters only exist once the group is created,
+	// so the snapshotting one can only be set afterwards.
+	if v, ok := d.GetOk("snapshotting_cluster_id"); ok {
+		req := &elasticache.ModifyReplicationGroupInput{
+			ReplicationGroupId:    aws.String(d.Id()),
+			SnapshottingClusterId: aws.String(v.(string)),
+			ApplyImmediately:      aws.Bool(true),
+		}
+		if err := modifyReplicationGroupAndWait(ctx, conn, req, "", timeout); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := d.GetOk("primary_availability_zone"); ok {
+		if err := rebalanceReplicationGroup(ctx, d, conn, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createReplicationGroup requests a new replication group and waits
+// for it to become available. The resource ID is set as soon as the
+// group is requested.
+func createReplicationGroup(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache, req *elasticache.CreateReplicationGroupInput, timeout time.Duration) error {
+	events := newElasticacheEventLog(ctx, conn, strings.ToLower(*req.ReplicationGroupId))
+	var createdId string
+	resp, err := conn.CreateReplicationGroupWithContext(ctx, req)
+	if err == nil {
+		createdId = *resp.ReplicationGroup.ReplicationGroupId
+	} else if rg := interruptedReplicationGroupCreation(ctx, conn, req, timeout, err); rg != nil {
+		log.Printf("[INFO] ElastiCache Replication Group (%s) is left behind by an interrupted create (status: %s), resuming the wait", *rg.ReplicationGroupId, *rg.Status)
+		createdId = *rg.ReplicationGroupId
+	} else {
 		return fmt.Errorf("Error creating Elasticache: %s", err)
 	}
 
@@ -384,120 +809,166 @@ func resourceAwsElasticacheReplictaionGroupCreate(d *schema.ResourceData, meta i
 	// Elasticache always retains the id in lower case, so we have to
 	// mimic that or else we won't be able to refresh a resource whose
 	// name contained uppercase characters.
-	d.SetId(strings.ToLower(*resp.ReplicationGroup.ReplicationGroupId))
+	d.SetId(strings.ToLower(createdId))
+	d.MarkNewResource()
 
 	pending := []string{"creating", "modifying"}
+	refresh := creatingGracePeriodRefreshFunc(replicationGroupStateRefreshFunc(ctx, conn, d.Id(), "available", pending),
+		d.Id(), replicationGroupCreateGracePeriod)
 	stateConf := &resource.StateChangeConf{
 		Pending:    pending,
 		Target:     []string{"available"},
-		Refresh:    replicationGroupStateRefreshFunc(conn, d.Id(), "available", pending),
-		Timeout:    20 * time.Minute,
+		Refresh:    events.refreshFunc(refresh),
+		Timeout:    timeout,
 		Delay:      10 * time.Second,
 		MinTimeout: 3 * time.Second,
 	}
 
 	log.Printf("[DEBUG] Waiting for state to become available: %v", d.Id())
-	_, sterr := stateConf.WaitForState()
+	_, sterr := waitForState(ctx, stateConf, "the replication group")
 	if sterr != nil {
-		return fmt.Errorf("Error waiting for elasticache (%s) to be created: %s", d.Id(), sterr)
+		return fmt.Errorf("Error waiting for elasticache (%s) to be created: %s%s", d.Id(), sterr, events)
 	}
 
-	return resourceAwsElasticacheReplictaionGroupRead(d, meta)
+	return nil
 }
 
 func resourceAwsElasticacheReplictaionGroupRead(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*elasticache.ElastiCache)
-	req := &elasticache.DescribeReplicationGroupsInput{
-		ReplicationGroupId: aws.String(d.Id()),
-	}
+	client := meta.(*AWSClient)
+	conn := client.elasticacheconn
+	ctx := client.stopCtx
 
-	res, err := conn.DescribeReplicationGroups(req)
+	rg, err := client.describeCache.replicationGroup(ctx, conn, d.Id())
 	if err != nil {
-		if eccErr, ok := err.(awserr.Error); ok && eccErr.Code() == "ReplicationGroupNotFoundFault" {
-			log.Printf("[WARN] ElastiCache Replication group (%s) not found", d.Id())
-			d.SetId("")
-			return nil
-		}
-
 		return err
 	}
+	if rg == nil {
+		// Describe calls can miss a group that has just been created,
+		// so only a group from an earlier apply can be dropped here.
+		if d.IsNewResource() {
+			return fmt.Errorf("ElastiCache Replication group (%s) not found right after it was created", d.Id())
+		}
+		log.Printf("[WARN] ElastiCache Replication group (%s) not found", d.Id())
+		d.SetId("")
+		return nil
+	}
 
-	if len(res.ReplicationGroups) == 1 {
-		rg := res.ReplicationGroups[0]
+	// A blue/green replacement keeps the configured id
+	if !isReplicationGroupReplacement(d.Get("replication_group_id").(string), aws.StringValue(rg.ReplicationGroupId)) {
 		d.Set("replication_group_id", rg.ReplicationGroupId)
-		d.Set("automatic_failover", rg.AutomaticFailover)
-
-		var groupMembers []*elasticache.NodeGroupMember
-		if len(rg.NodeGroups) == 1 {
-			groupMembers = rg.NodeGroups[0].NodeGroupMembers
-			log.Printf("[DEBUG] Setting an endpoint info")
-			d.Set("endpoint_address", *rg.NodeGroups[0].PrimaryEndpoint.Address)
-			d.Set("endpoint", map[string]interface{}{
-				"address": *rg.NodeGroups[0].PrimaryEndpoint.Address,
-				"port":    int(*rg.NodeGroups[0].PrimaryEndpoint.Port),
-			})
-		}
+	}
+	d.Set("automatic_failover", rg.AutomaticFailover)
+	d.Set("multi_az_enabled", aws.StringValue(rg.MultiAZ) == elasticache.MultiAZStatusEnabled)
+	d.Set("network_type", rg.NetworkType)
+	// Not reported by every API version, the configured value stays then
+	if rg.AutoMinorVersionUpgrade != nil {
+		d.Set("auto_minor_version_upgrade", rg.AutoMinorVersionUpgrade)
+	}
+	d.Set("transit_encryption_enabled", aws.BoolValue(rg.TransitEncryptionEnabled))
+	d.Set("transit_encryption_mode", rg.TransitEncryptionMode)
+	d.Set("user_group_ids", flattenStringList(rg.UserGroupIds))
+	globalID, globalMemberOf, globalRole := flattenGlobalReplicationGroupInfo(rg.GlobalReplicationGroupInfo)
+	d.Set("global_replication_group_id", globalID)
+	d.Set("global_replication_group_member_of", globalMemberOf)
+	d.Set("global_replication_group_role", globalRole)
+	d.Set("ip_discovery", rg.IpDiscovery)
+	if err := d.Set("log_delivery_configuration", flattenLogDeliveryConfigurations(rg.LogDeliveryConfigurations)); err != nil {
+		return fmt.Errorf("[DEBUG] Error setting log_delivery_configuration for (%s): %s", d.Id(), err)
+	}
+
+	var groupMembers []*elasticache.NodeGroupMember
+	if len(rg.NodeGroups) == 1 {
+		groupMembers = rg.NodeGroups[0].NodeGroupMembers
+		log.Printf("[DEBUG] Setting an endpoint info")
+		d.Set("endpoint_address", *rg.NodeGroups[0].PrimaryEndpoint.Address)
+		d.Set("endpoint", map[string]interface{}{
+			"address": *rg.NodeGroups[0].PrimaryEndpoint.Address,
+			"port":    int(*rg.NodeGroups[0].PrimaryEndpoint.Port),
+		})
+	}
 
-		numReplicas := len(groupMembers)
-		d.Set("num_cache_clusters", numReplicas)
-		if numReplicas > 0 {
-			cacheNodeData := make([]map[string]interface{}, 0, numReplicas)
+	numReplicas := len(groupMembers)
+	d.Set("num_cache_clusters", numReplicas)
+	if numReplicas > 0 {
+		memberIds := make([]string, 0, numReplicas)
+		for _, gm := range groupMembers {
+			memberIds = append(memberIds, *gm.CacheClusterId)
+		}
+		if _, ok := d.GetOk("primary_availability_zone"); ok {
 			for _, node := range groupMembers {
-				cacheNodeData = append(cacheNodeData, map[string]interface{}{
-					"id":                *node.CacheClusterId,
-					"role":              *node.CurrentRole,
-					"address":           *node.ReadEndpoint.Address,
-					"port":              int(*node.ReadEndpoint.Port),
-					"availability_zone": *node.PreferredAvailabilityZone,
-				})
+				if aws.StringValue(node.CurrentRole) == "primary" {
+					d.Set("primary_availability_zone", node.PreferredAvailabilityZone)
+				}
 			}
-			d.Set("cache_nodes", cacheNodeData)
+		}
 
-			for i, gm := range groupMembers {
-				req := &elasticache.DescribeCacheClustersInput{
-					CacheClusterId:    gm.CacheClusterId,
-					ShowCacheNodeInfo: aws.Bool(true),
-				}
+		snapshottingClusterId := aws.StringValue(rg.SnapshottingClusterId)
+		clusters, err := client.describeCache.memberClusters(ctx, conn, d.Id(), memberIds)
+		if err != nil {
+			return err
+		}
+
+		d.Set("parameter_apply_status", replicationGroupParameterApplyStatus(memberIds, clusters))
+
+		cacheNodeData := make([]map[string]interface{}, 0, numReplicas)
+		for _, node := range groupMembers {
+			cacheNodeData = append(cacheNodeData, map[string]interface{}{
+				"id":                *node.CacheClusterId,
+				"role":              *node.CurrentRole,
+				"address":           *node.ReadEndpoint.Address,
+				"port":              int(*node.ReadEndpoint.Port),
+				"availability_zone": *node.PreferredAvailabilityZone,
+				// Merged in from the member's own description
+				"parameter_apply_status": memberParameterApplyStatus(clusters[*node.CacheClusterId]),
+			})
+		}
+		d.Set("cache_nodes", cacheNodeData)
+
+		if _, ok := d.GetOk("snapshotting_cluster_id"); ok {
+			d.Set("snapshotting_cluster_id", snapshottingClusterId)
+		}
 
-				res, err := conn.DescribeCacheClusters(req)
+		// Fill group's parameters from the first
+		// replica. They have to be the same for all replicas.
+		if c := clusters[memberIds[0]]; c != nil {
+			d.Set("node_type", c.CacheNodeType)
+			d.Set("num_cache_nodes", c.NumCacheNodes)
+			d.Set("engine", c.Engine)
+			d.Set("engine_version", c.EngineVersion)
+			d.Set("subnet_group_name", c.CacheSubnetGroupName)
+			d.Set("security_group_names", c.CacheSecurityGroups)
+			d.Set("security_group_ids", c.SecurityGroups)
+			if c.CacheParameterGroup != nil {
+				d.Set("parameter_group_name", c.CacheParameterGroup.CacheParameterGroupName)
+
+				// Parameter blocks track the values of the managed group
+				managed, _, err := managedParameterGroup(d)
 				if err != nil {
 					return err
 				}
-				var c *elasticache.CacheCluster
-				if len(res.CacheClusters) == 1 {
-					c = res.CacheClusters[0]
-				}
-
-				// Fill group's parameters from the first
-				// replica. They have to be the same for all replicas.
-				if c != nil && i == 0 {
-					d.Set("node_type", c.CacheNodeType)
-					d.Set("num_cache_nodes", c.NumCacheNodes)
-					d.Set("engine", c.Engine)
-					d.Set("engine_version", c.EngineVersion)
-					d.Set("subnet_group_name", c.CacheSubnetGroupName)
-					d.Set("security_group_names", c.CacheSecurityGroups)
-					d.Set("security_group_ids", c.SecurityGroups)
-					d.Set("parameter_group_name", c.CacheParameterGroup)
-					d.Set("maintenance_window", c.PreferredMaintenanceWindow)
-					if c.NotificationConfiguration != nil {
-						if *c.NotificationConfiguration.TopicStatus == "active" {
-							d.Set("notification_topic_arn", c.NotificationConfiguration.TopicArn)
-						}
+				if managed != "" && managed == aws.StringValue(c.CacheParameterGroup.CacheParameterGroupName) {
+					params, err := describeUserParameters(ctx, conn, managed)
+					if err != nil {
+						return err
 					}
-
-					d.Set("snapshot_window", c.SnapshotWindow)
-					d.Set("snapshot_retention_limit", c.SnapshotRetentionLimit)
+					d.Set("parameter", flattenParameters(params))
 				}
-
-				// Since there is no way to know in advance which replica is used
-				// for snapshotting all must be checked.
-				if c != nil && c.SnapshotRetentionLimit != nil && *c.SnapshotRetentionLimit > 0 {
-					d.Set("snapshot_window", c.SnapshotWindow)
-					d.Set("snapshot_retention_limit", c.SnapshotRetentionLimit)
-					break
+			}
+			d.Set("maintenance_window", c.PreferredMaintenanceWindow)
+			if c.NotificationConfiguration != nil {
+				if *c.NotificationConfiguration.TopicStatus == "active" {
+					d.Set("notification_topic_arn", c.NotificationConfiguration.TopicArn)
 				}
 			}
+
+			d.Set("snapshot_window", c.SnapshotWindow)
+			d.Set("snapshot_retention_limit", c.SnapshotRetentionLimit)
+		}
+
+		// Snapshot settings are kept by the snapshotting cluster
+		if c := clusters[snapshottingClusterId]; c != nil {
+			d.Set("snapshot_window", c.SnapshotWindow)
+			d.Set("snapshot_retention_limit", c.SnapshotRetentionLimit)
 		}
 	}
 
@@ -505,70 +976,184 @@ func resourceAwsElasticacheReplictaionGroupRead(d *schema.ResourceData, meta int
 }
 
 func resourceAwsElasticacheReplictaionGroupDelete(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*elasticache.ElastiCache)
+	client := meta.(*AWSClient)
+	conn := client.elasticacheconn
+	ctx := client.stopCtx
+
+	// The value comes from the state here, so a replacement caused by
+	// a ForceNew attribute is refused even if the same apply also turns
+	// the protection off. The protection has to be lifted first.
+	if d.Get("deletion_protection").(bool) {
+		return fmt.Errorf("ElastiCache Replication Group (%s) has deletion_protection enabled, "+
+			"it can't be deleted or replaced until deletion_protection is set to false and applied", d.Id())
+	}
 
-	req := &elasticache.DeleteReplicationGroupInput{
-		ReplicationGroupId: aws.String(d.Id()),
-		// TODO retain primary?
+	client.describeCache.invalidate(d.Id())
+	if err := deleteReplicationGroup(ctx, conn, d.Id(), d.Timeout(schema.TimeoutDelete)); err != nil {
+		return err
 	}
-	if _, err := conn.DeleteReplicationGroup(req); err != nil {
+
+	if name, _, err := managedParameterGroup(d); err != nil {
 		return err
+	} else if name != "" {
+		if err := deleteManagedParameterGroup(ctx, conn, name, d.Timeout(schema.TimeoutDelete)); err != nil {
+			return err
+		}
 	}
 
-	log.Printf("[DEBUG] Waiting for deletion: %v", d.Id())
-	stateConf := &resource.StateChangeConf{
-		Pending:    []string{"creating", "available", "deleting", "incompatible-parameters", "incompatible-network", "restore-failed"},
-		Target:     []string{},
-		Refresh:    replicationGroupStateRefreshFunc(conn, d.Id(), "", []string{}),
-		Timeout:    20 * time.Minute,
-		Delay:      10 * time.Second,
-		MinTimeout: 3 * time.Second,
+	d.SetId("")
+
+	return nil
+}
+
+func resourceAwsElasticacheReplictaionGroupUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*AWSClient)
+	conn := client.elasticacheconn
+	ctx := client.stopCtx
+	deadline := time.Now().Add(d.Timeout(schema.TimeoutUpdate))
+
+	client.describeCache.invalidate(d.Id())
+
+	// Update consists of several steps and each of them commits its
+	// attributes to the state only after it has succeeded. This way
+	// a failure halfway through doesn't lose the progress made so far
+	// and a rerun resumes from the failed step.
+	d.Partial(true)
+
+	if err := updateReplicationGroupParameters(ctx, d, conn); err != nil {
+		return err
 	}
 
-	_, sterr := stateConf.WaitForState()
-	if sterr != nil {
-		return fmt.Errorf("Error waiting for elasticache (%s) to delete: %s", d.Id(), sterr)
+	if changed := replicationGroupReplacingChanges(d); len(changed) > 0 {
+		if err := replaceReplicationGroup(ctx, d, meta, changed, time.Until(deadline)); err != nil {
+			return err
+		}
+		return cleanUpManagedParameterGroup(ctx, d, conn, time.Until(deadline))
 	}
 
-	d.SetId("")
+	if err := updateReplicationGroupGlobalMembership(ctx, d, conn); err != nil {
+		return err
+	}
+
+	if err := updateReplicationGroupEngineVersion(ctx, d, conn, time.Until(deadline)); err != nil {
+		return err
+	}
+
+	if err := updateReplicationGroupTransitEncryption(ctx, d, conn); err != nil {
+		return err
+	}
+
+	if err := updateReplicationGroupPlacement(ctx, d, conn, time.Until(deadline)); err != nil {
+		return err
+	}
+
+	converging, err := updateReplicationGroupAttributes(ctx, d, conn)
+	if err != nil {
+		return err
+	}
+
+	if err := cleanUpManagedParameterGroup(ctx, d, conn, time.Until(deadline)); err != nil {
+		return err
+	}
+
+	if d.Get("reboot_on_parameter_change").(bool) {
+		if err := rebootReplicationGroupMembers(ctx, conn, d.Id(), time.Until(deadline)); err != nil {
+			return err
+		}
+	}
 
+	d.Partial(false)
+
+	// Whatever is left of the update timeout
+	if err := readReplicationGroupUntilConverged(ctx, d, meta, converging, time.Until(deadline)); err != nil {
+		return err
+	}
+	return waitForReplicationGroupReady(ctx, d)
+}
+
+// updateReplicationGroupGlobalMembership is the update step that
+// detaches the group from its Global Datastore.
+func updateReplicationGroupGlobalMembership(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache) error {
+	if !d.HasChange("global_replication_group_id") {
+		return nil
+	}
+
+	o, n := d.GetChange("global_replication_group_id")
+	if n.(string) != "" {
+		return fmt.Errorf("ElastiCache Replication Group (%s) can only join a Global Datastore when it is created", d.Id())
+	}
+	if role, _ := d.GetChange("global_replication_group_role"); role.(string) == "primary" {
+		return fmt.Errorf("ElastiCache Replication Group (%s) is the primary of Global Datastore (%s) and can't be detached from it",
+			d.Id(), d.Get("global_replication_group_member_of").(string))
+	}
+
+	err := disassociateGlobalReplicationGroup(ctx, conn, o.(string), d.Id(), d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return err
+	}
+
+	d.SetPartial("global_replication_group_id")
 	return nil
 }
 
-func resourceAwsElasticacheReplictaionGroupUpdate(d *schema.ResourceData, meta interface{}) error {
-	conn := meta.(*elasticache.ElastiCache)
-	requestUpdate := false
+// Attributes that Read reports exactly as they are configured, so that
+// a modification applied immediately can be verified against them.
+var replicationGroupConvergingAttributes = []string{
+	"node_type",
+	"parameter_group_name",
+	"maintenance_window",
+	"engine",
+	"snapshot_window",
+	"snapshot_retention_limit",
+	"automatic_failover",
+	"multi_az_enabled",
+	"ip_discovery",
+}
+
+// updateReplicationGroupAttributes is the update step that applies
+// everything ModifyReplicationGroup is able to change in a single call.
+// It returns the modified attributes that Read has to catch up with.
+func updateReplicationGroupAttributes(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache) ([]string, error) {
+	var modified []string
+
+	// Already applied by updateReplicationGroupEngineVersion
+	majorUpgrade := isOrchestratedMajorUpgrade(d)
 
 	req := &elasticache.ModifyReplicationGroupInput{
 		ReplicationGroupId: aws.String(d.Id()),
 		ApplyImmediately:   aws.Bool(d.Get("apply_immediately").(bool)),
 	}
 
-	if d.HasChange("note_type") {
+	if d.HasChange("description") {
 		req.ReplicationGroupDescription = aws.String(d.Get("description").(string))
-		requestUpdate = true
+		modified = append(modified, "description")
 	}
 
-	if d.HasChange("note_type") {
+	if d.HasChange("node_type") {
 		req.CacheNodeType = aws.String(d.Get("node_type").(string))
-		requestUpdate = true
+		modified = append(modified, "node_type")
 	}
 
 	if d.HasChange("security_group_ids") {
 		if attr := d.Get("security_group_ids").(*schema.Set); attr.Len() > 0 {
 			req.SecurityGroupIds = expandStringList(attr.List())
-			requestUpdate = true
+			modified = append(modified, "security_group_ids")
 		}
 	}
 
-	if d.HasChange("parameter_group_name") {
-		req.CacheParameterGroupName = aws.String(d.Get("parameter_group_name").(string))
-		requestUpdate = true
+	parameterGroupName, parameterGroupChanged, err := replicationGroupParameterGroup(d)
+	if err != nil {
+		return nil, err
+	}
+	if parameterGroupChanged && !majorUpgrade {
+		req.CacheParameterGroupName = aws.String(parameterGroupName)
+		d.Set("parameter_group_name", parameterGroupName)
+		modified = append(modified, "parameter_group_name")
 	}
 
 	if d.HasChange("maintenance_window") {
 		req.PreferredMaintenanceWindow = aws.String(d.Get("maintenance_window").(string))
-		requestUpdate = true
+		modified = append(modified, "maintenance_window")
 	}
 
 	if d.HasChange("notification_topic_arn") {
@@ -578,39 +1163,56 @@ func resourceAwsElasticacheReplictaionGroupUpdate(d *schema.ResourceData, meta i
 			inactive := "inactive"
 			req.NotificationTopicStatus = &inactive
 		}
-		requestUpdate = true
+		modified = append(modified, "notification_topic_arn")
 	}
 
-	if d.HasChange("engine_version") {
+	if d.HasChange("engine_version") && !majorUpgrade {
+		req.EngineVersion = aws.String(d.Get("engine_version").(string))
+		modified = append(modified, "engine_version")
+	}
+
+	var engine string
+	if d.HasChange("engine") {
+		o, n := d.GetChange("engine")
+		if o.(string) == "valkey" && n.(string) == "redis" {
+			return nil, fmt.Errorf("ElastiCache Replication Group (%s) can't be moved from valkey back to redis, it has to be recreated", d.Id())
+		}
+		engine = n.(string)
+		// ElastiCache requires the target version along with the engine
 		req.EngineVersion = aws.String(d.Get("engine_version").(string))
-		requestUpdate = true
+		modified = append(modified, "engine")
+	}
+
+	if (d.HasChange("engine") || d.HasChange("engine_version") || parameterGroupChanged) && !majorUpgrade {
+		err := validateEngineConfiguration(ctx, conn, d.Get("engine").(string),
+			d.Get("engine_version").(string), parameterGroupName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.HasChange("auto_minor_version_upgrade") {
+		req.AutoMinorVersionUpgrade = aws.Bool(d.Get("auto_minor_version_upgrade").(bool))
+		modified = append(modified, "auto_minor_version_upgrade")
 	}
 
 	if d.HasChange("snapshot_window") {
 		req.SnapshotWindow = aws.String(d.Get("snapshot_window").(string))
-		requestUpdate = true
+		modified = append(modified, "snapshot_window")
 	}
 
 	if d.HasChange("snapshot_retention_limit") {
-		var snapshotNodeId string
-		if v, ok := d.GetOk("cache_nodes"); ok {
-			cacheNodeData := v.([]interface{})
-			for i, nodeInterface := range cacheNodeData {
-				node := nodeInterface.(map[string]interface{})
-				// pick the "best" replica for snapshotting
-				// - if there is just one — then use it even if it's primary
-				// - if there are several — use the last non-primary in the list
-				if i == 0 || node["role"].(string) != "primary" {
-					snapshotNodeId = node["id"].(string)
-				}
-			}
-		}
-		if snapshotNodeId != "" {
-			req.SnapshottingClusterId = aws.String(snapshotNodeId)
-			req.SnapshotRetentionLimit = aws.Int64(int64(d.Get("snapshot_retention_limit").(int)))
-			requestUpdate = true
+		req.SnapshotRetentionLimit = aws.Int64(int64(d.Get("snapshot_retention_limit").(int)))
+		modified = append(modified, "snapshot_retention_limit")
+	}
 
-		}
+	snapshottingClusterId, err := replicationGroupSnapshottingCluster(ctx, d, conn)
+	if err != nil {
+		return nil, err
+	}
+	if snapshottingClusterId != "" {
+		req.SnapshottingClusterId = aws.String(snapshottingClusterId)
+		modified = append(modified, "snapshotting_cluster_id")
 	}
 
 	automaticFailoverEnabled := false
@@ -620,46 +1222,528 @@ func resourceAwsElasticacheReplictaionGroupUpdate(d *schema.ResourceData, meta i
 
 	if d.HasChange("automatic_failover") {
 		req.AutomaticFailoverEnabled = aws.Bool(automaticFailoverEnabled)
-		requestUpdate = true
+		modified = append(modified, "automatic_failover")
+	}
+
+	multiAZ, multiAZChanged := replicationGroupMultiAZ(d.Get("multi_az_enabled").(bool), d.HasChange("multi_az_enabled"),
+		automaticFailoverEnabled, d.HasChange("automatic_failover"))
+	if multiAZChanged {
+		req.MultiAZEnabled = aws.Bool(multiAZ)
+		d.Set("multi_az_enabled", multiAZ)
+		modified = append(modified, "multi_az_enabled")
+	}
+
+	if d.HasChange("multi_az_enabled") || d.HasChange("automatic_failover") {
+		if err := validateReplicationGroupMultiAZ(d); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.HasChange("ip_discovery") {
+		req.IpDiscovery = aws.String(d.Get("ip_discovery").(string))
+		err := validateReplicationGroupNetwork(ctx, conn, d.Get("subnet_group_name").(string),
+			d.Get("network_type").(string), d.Get("ip_discovery").(string))
+		if err != nil {
+			return nil, err
+		}
+		modified = append(modified, "ip_discovery")
+	}
+
+	var attachedUserGroups, detachedUserGroups []string
+	if d.HasChange("user_group_ids") {
+		o, n := d.GetChange("user_group_ids")
+		attachedUserGroups, detachedUserGroups = setUserGroupChanges(req, o.(*schema.Set), n.(*schema.Set))
+		modified = append(modified, "user_group_ids")
 	}
 
-	if requestUpdate {
-		log.Printf("[DEBUG] Modifying ElastiCache Replication Group (%s), opts:\n%s", d.Id(), req)
-		_, err := conn.ModifyReplicationGroup(req)
+	if d.HasChange("log_delivery_configuration") {
+		o, n := d.GetChange("log_delivery_configuration")
+		configs, err := diffLogDeliveryConfigurations(o.(*schema.Set), n.(*schema.Set))
 		if err != nil {
-			return fmt.Errorf("[WARN] Error updating ElastiCache replication group (%s), error: %s", d.Id(), err)
+			return nil, err
+		}
+		req.LogDeliveryConfigurations = configs
+		modified = append(modified, "log_delivery_configuration")
+	}
+
+	if len(modified) == 0 {
+		return nil, nil
+	}
+
+	if err := modifyReplicationGroupAndWait(ctx, conn, req, engine, d.Timeout(schema.TimeoutUpdate)); err != nil {
+		return nil, err
+	}
+
+	err = waitForUserGroupAssociations(ctx, conn, d.Id(), attachedUserGroups, detachedUserGroups, d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range modified {
+		d.SetPartial(k)
+	}
+	d.SetPartial("apply_immediately")
+
+	// Pending modifications only show up after the maintenance window
+	if !*req.ApplyImmediately {
+		return nil, nil
+	}
+	var converging []string
+	for _, k := range modified {
+		if stringInSlice(k, replicationGroupConvergingAttributes) {
+			converging = append(converging, k)
+		}
+	}
+	return converging, nil
+}
+
+// readReplicationGroupUntilConverged reads the group into the state and,
+// since ElastiCache is eventually consistent, keeps re-reading it until
+// the given attributes report the values they were modified to.
+func readReplicationGroupUntilConverged(ctx context.Context, d *schema.ResourceData, meta interface{}, attributes []string, timeout time.Duration) error {
+	expected := convergingValues(d, attributes)
+
+	err := retry(ctx, timeout, func() *resource.RetryError {
+		if err := resourceAwsElasticacheReplictaionGroupRead(d, meta); err != nil {
+			return resource.NonRetryableError(err)
+		}
+		if d.Id() == "" {
+			return resource.NonRetryableError(fmt.Errorf("the replication group is gone"))
+		}
+		if diverged := divergedAttributes(d, expected); len(diverged) > 0 {
+			log.Printf("[DEBUG] ElastiCache Replication Group (%s) hasn't converged yet: %s", d.Id(), strings.Join(diverged, ", "))
+			return resource.RetryableError(fmt.Errorf("attributes haven't converged: %s", strings.Join(diverged, ", ")))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading elasticache (%s) after the update: %s", d.Id(), err)
+	}
+	return nil
+}
+
+// convergingValues returns the values the attributes have to be read
+// back with, the configured ones as Read reports them.
+func convergingValues(d *schema.ResourceData, attributes []string) map[string]interface{} {
+	expected := make(map[string]interface{}, len(attributes))
+	for _, k := range attributes {
+		expected[k] = d.Get(k)
+	}
+	// Read gets it back in lowercase, see the StateFunc
+	if v, ok := expected["maintenance_window"]; ok {
+		expected["maintenance_window"] = strings.ToLower(v.(string))
+	}
+	return expected
+}
+
+// divergedAttributes describes the attributes whose values in d
+// differ from the expected ones, e.g. `node_type ("cache.m3.medium", expected "cache.m3.large")`.
+func divergedAttributes(d *schema.ResourceData, expected map[string]interface{}) []string {
+	var diverged []string
+	for _, k := range replicationGroupConvergingAttributes {
+		want, ok := expected[k]
+		if !ok {
+			continue
+		}
+		if got := d.Get(k); got != want {
+			diverged = append(diverged, fmt.Sprintf("%s (%#v, expected %#v)", k, got, want))
+		}
+	}
+	return diverged
+}
+
+// replicationGroupSnapshottingCluster returns the member that has to be
+// set as the snapshotting cluster by the update, or "" if it stays as is.
+// The configured snapshotting_cluster_id is set whenever it changes.
+// Otherwise, while snapshots are enabled, the automatic policy of
+// autoSnapshottingCluster is followed.
+func replicationGroupSnapshottingCluster(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache) (string, error) {
+	if v, ok := d.GetOk("snapshotting_cluster_id"); ok {
+		if d.HasChange("snapshotting_cluster_id") {
+			return v.(string), nil
+		}
+		return "", nil
+	}
+
+	if d.Get("snapshot_retention_limit").(int) == 0 {
+		return "", nil
+	}
+
+	rg, err := describeReplicationGroup(ctx, conn, d.Id())
+	if err != nil {
+		return "", err
+	}
+	if rg == nil || len(rg.NodeGroups) != 1 {
+		return "", nil
+	}
+
+	current := aws.StringValue(rg.SnapshottingClusterId)
+	id := autoSnapshottingCluster(current, rg.NodeGroups[0].NodeGroupMembers)
+	if id != current || d.HasChange("snapshot_retention_limit") {
+		log.Printf("[DEBUG] Automatically selected snapshotting cluster for (%s): %q", d.Id(), id)
+		return id, nil
+	}
+	return "", nil
+}
+
+// autoSnapshottingCluster is the policy used when snapshotting_cluster_id
+// is not configured. The current snapshotting cluster is kept as long as
+// it is still a replica of the group. Otherwise the replica with the
+// greatest cluster id is picked, so that snapshots don't load the primary.
+// A group without replicas has to use its primary.
+func autoSnapshottingCluster(current string, members []*elasticache.NodeGroupMember) string {
+	var replicas []string
+	for _, m := range members {
+		if aws.StringValue(m.CurrentRole) == "primary" {
+			continue
+		}
+		if *m.CacheClusterId == current {
+			return current
 		}
+		replicas = append(replicas, *m.CacheClusterId)
+	}
+
+	if len(replicas) > 0 {
+		sort.Strings(replicas)
+		return replicas[len(replicas)-1]
+	}
+	if len(members) == 1 {
+		return *members[0].CacheClusterId
+	}
+	return ""
+}
+
+// modifyReplicationGroupAndWait requests the modification once the group
+// is done with whatever it is busy with and waits for it to be applied.
+func modifyReplicationGroupAndWait(ctx context.Context, conn *elasticache.ElastiCache, req *elasticache.ModifyReplicationGroupInput, engine string, timeout time.Duration) error {
+	replGroupID := *req.ReplicationGroupId
+	deadline := time.Now().Add(timeout)
+	if err := waitForReplicationGroupOperationInProgress(ctx, conn, replGroupID, timeout); err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Modifying ElastiCache Replication Group (%s), opts:\n%s", replGroupID, req)
+	events := newElasticacheEventLog(ctx, conn, replGroupID)
+	err := retryWhileReplicationGroupBusy(ctx, conn, replGroupID, deadline, func() error {
+		err := modifyReplicationGroup(ctx, conn, req, engine)
+		if isAWSErr(err, "InvalidParameterCombination", "No modifications were requested") {
+			// An interrupted apply has requested these very changes already
+			log.Printf("[INFO] ElastiCache Replication Group (%s) has nothing left to modify", replGroupID)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("[WARN] Error updating ElastiCache replication group (%s), error: %s", replGroupID, err)
+	}
+
+	log.Printf("[DEBUG] Waiting for update: %s", replGroupID)
+	pending := []string{"modifying", "snapshotting"}
+	stateConf := &resource.StateChangeConf{
+		Pending:    pending,
+		Target:     []string{"available"},
+		Refresh:    events.refreshFunc(replicationGroupStateRefreshFunc(ctx, conn, replGroupID, "available", pending)),
+		Timeout:    time.Until(deadline),
+		Delay:      5 * time.Second,
+		MinTimeout: 3 * time.Second,
+	}
+
+	_, sterr := waitForState(ctx, stateConf, "the replication group")
+	if sterr != nil {
+		return fmt.Errorf("Error waiting for elasticache (%s) to update: %s%s", replGroupID, sterr, events)
+	}
+
+	return nil
+}
+
+// replicationGroupMultiAZ returns the Multi-AZ setting to apply and
+// whether it has to be sent. multi_az_enabled is computed, so with
+// nothing configured the state keeps what Read has found; that value
+// is turned off along with automatic failover, which it requires.
+func replicationGroupMultiAZ(multiAZ, multiAZChanged, failover, failoverChanged bool) (bool, bool) {
+	if failoverChanged && !failover && multiAZ && !multiAZChanged {
+		return false, true
+	}
+	return multiAZ, multiAZChanged
+}
+
+// validateReplicationGroupMultiAZ checks what AWS requires from
+// a Multi-AZ group: automatic failover and at least one replica
+// placed in a different availability zone than the primary.
+func validateReplicationGroupMultiAZ(d *schema.ResourceData) error {
+	if !d.Get("multi_az_enabled").(bool) {
+		return nil
+	}
 
-		log.Printf("[DEBUG] Waiting for update: %s", d.Id())
-		pending := []string{"modifying", "snapshotting"}
+	if d.Get("automatic_failover").(string) != elasticache.AutomaticFailoverStatusEnabled {
+		return fmt.Errorf("multi_az_enabled requires automatic_failover to be enabled")
+	}
+	if d.Get("num_cache_clusters").(int) < 2 {
+		return fmt.Errorf("multi_az_enabled requires at least one replica (num_cache_clusters >= 2)")
+	}
+	if azs := d.Get("availability_zones").(*schema.Set); azs.Len() > 0 && azs.Len() < 2 {
+		return fmt.Errorf("multi_az_enabled requires at least two availability_zones, got: %v", azs.List())
+	}
+
+	return nil
+}
+
+// describeReplicationGroup returns nil if the replication group doesn't exist.
+func describeReplicationGroup(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string) (*elasticache.ReplicationGroup, error) {
+	res, err := conn.DescribeReplicationGroupsWithContext(ctx, &elasticache.DescribeReplicationGroupsInput{
+		ReplicationGroupId: aws.String(replGroupID),
+	})
+	if err != nil {
+		if isAWSErr(err, "ReplicationGroupNotFoundFault", "") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, rg := range res.ReplicationGroups {
+		if *rg.ReplicationGroupId == replGroupID {
+			return rg, nil
+		}
+	}
+	return nil, nil
+}
+
+// interruptedReplicationGroupCreation looks for a group left behind by
+// an interrupted create of the very same replication group, so that
+// the wait can be resumed instead of failing with "already exists".
+// Only a group tagged with the token of the request is taken over,
+// it returns nil for any other one.
+func interruptedReplicationGroupCreation(ctx context.Context, conn *elasticache.ElastiCache, req *elasticache.CreateReplicationGroupInput, timeout time.Duration, err error) *elasticache.ReplicationGroup {
+	if !isAWSErr(err, "ReplicationGroupAlreadyExists", "") {
+		return nil
+	}
+
+	rg, derr := describeReplicationGroup(ctx, conn, strings.ToLower(*req.ReplicationGroupId))
+	if derr != nil || rg == nil {
+		return nil
+	}
+
+	if !hasReplicationGroupCreateToken(ctx, conn, rg, req) {
+		return nil
+	}
+
+	switch *rg.Status {
+	case "creating":
+		return rg
+	case "available", "modifying":
+		// the interrupted create may have finished since then,
+		// but it could not have been earlier than the timeout
+		if rg.ReplicationGroupCreateTime != nil && time.Since(*rg.ReplicationGroupCreateTime) < timeout {
+			return rg
+		}
+	}
+	return nil
+}
+
+func hasReplicationGroupCreateToken(ctx context.Context, conn *elasticache.ElastiCache, rg *elasticache.ReplicationGroup, req *elasticache.CreateReplicationGroupInput) bool {
+	var token string
+	for _, t := range req.Tags {
+		if aws.StringValue(t.Key) == replicationGroupCreateTokenTag {
+			token = aws.StringValue(t.Value)
+		}
+	}
+	if token == "" || rg.ARN == nil {
+		return false
+	}
+
+	res, err := conn.ListTagsForResourceWithContext(ctx, &elasticache.ListTagsForResourceInput{
+		ResourceName: rg.ARN,
+	})
+	if err != nil {
+		log.Printf("[WARN] Error listing tags of ElastiCache Replication Group (%s): %s", *rg.ReplicationGroupId, err)
+		return false
+	}
+	for _, t := range res.TagList {
+		if aws.StringValue(t.Key) == replicationGroupCreateTokenTag && aws.StringValue(t.Value) == token {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForReplicationGroupOperationInProgress waits for an operation that
+// is already running on the group, e.g. one requested by an interrupted
+// apply, to finish before the next one is requested.
+func waitForReplicationGroupOperationInProgress(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string, timeout time.Duration) error {
+	rg, err := describeReplicationGroup(ctx, conn, replGroupID)
+	if err != nil {
+		return err
+	}
+	if rg == nil {
+		return nil
+	}
+
+	pending := []string{"creating", "modifying", "snapshotting"}
+	inProgress := false
+	for _, p := range pending {
+		inProgress = inProgress || *rg.Status == p
+	}
+	if !inProgress {
+		return nil
+	}
+
+	log.Printf("[INFO] ElastiCache Replication Group (%s) is %s, waiting for it to finish", replGroupID, *rg.Status)
+	events := newElasticacheEventLog(ctx, conn, replGroupID)
+	stateConf := &resource.StateChangeConf{
+		Pending:    pending,
+		Target:     []string{"available"},
+		Refresh:    events.refreshFunc(replicationGroupStateRefreshFunc(ctx, conn, replGroupID, "available", pending)),
+		Timeout:    timeout,
+		Delay:      5 * time.Second,
+		MinTimeout: 3 * time.Second,
+	}
+
+	if _, sterr := waitForState(ctx, stateConf, "the replication group"); sterr != nil {
+		return fmt.Errorf("Error waiting for an operation in progress on elasticache (%s) to finish: %s%s", replGroupID, sterr, events)
+	}
+	return nil
+}
+
+func deleteReplicationGroup(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	req := &elasticache.DeleteReplicationGroupInput{
+		ReplicationGroupId: aws.String(replGroupID),
+		// TODO retain primary?
+	}
+	rg, err := describeReplicationGroup(ctx, conn, replGroupID)
+	if err != nil {
+		return err
+	}
+	if rg == nil {
+		log.Printf("[WARN] ElastiCache Replication group (%s) is already gone", replGroupID)
+		return nil
+	}
+
+	// A secondary has to leave its Global Datastore before it can be deleted
+	if info := rg.GlobalReplicationGroupInfo; info != nil && info.GlobalReplicationGroupId != nil &&
+		strings.ToLower(aws.StringValue(info.GlobalReplicationGroupMemberRole)) == "secondary" && *rg.Status != "deleting" {
+		if err := disassociateGlobalReplicationGroup(ctx, conn, *info.GlobalReplicationGroupId, replGroupID, time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+
+	events := newElasticacheEventLog(ctx, conn, replGroupID)
+	if *rg.Status == "deleting" {
+		// e.g. an apply was interrupted while waiting for the deletion
+		log.Printf("[INFO] ElastiCache Replication Group (%s) is already being deleted, resuming the wait", replGroupID)
+	} else {
+		err := retryWhileReplicationGroupBusy(ctx, conn, replGroupID, deadline, func() error {
+			_, err := conn.DeleteReplicationGroupWithContext(ctx, req)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[DEBUG] Waiting for deletion: %v", replGroupID)
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{"creating", "available", "deleting", "create-failed", "incompatible-parameters", "incompatible-network", "restore-failed"},
+		Target:     []string{},
+		Refresh:    events.refreshFunc(replicationGroupStateRefreshFunc(ctx, conn, replGroupID, "", []string{})),
+		Timeout:    time.Until(deadline),
+		Delay:      10 * time.Second,
+		MinTimeout: 3 * time.Second,
+	}
+
+	_, sterr := waitForState(ctx, stateConf, "the replication group")
+	if sterr != nil {
+		return fmt.Errorf("Error waiting for elasticache (%s) to delete: %s%s", replGroupID, sterr, events)
+	}
+
+	return nil
+}
+
+// deleteFailedReplicationGroup cleans up after a replication group
+// that ended up in create-failed, including the member clusters
+// that may outlive the group itself in this case.
+func deleteFailedReplicationGroup(ctx context.Context, conn *elasticache.ElastiCache, rg *elasticache.ReplicationGroup, timeout time.Duration) error {
+	if err := deleteReplicationGroup(ctx, conn, *rg.ReplicationGroupId, timeout); err != nil {
+		return err
+	}
+
+	for _, id := range rg.MemberClusters {
+		_, err := conn.DeleteCacheClusterWithContext(ctx, &elasticache.DeleteCacheClusterInput{
+			CacheClusterId: id,
+		})
+		if err != nil {
+			if isAWSErr(err, "CacheClusterNotFound", "") {
+				continue
+			}
+			return err
+		}
+
+		log.Printf("[DEBUG] Waiting for deletion of a left over cache cluster: %s", *id)
 		stateConf := &resource.StateChangeConf{
-			Pending:    pending,
-			Target:     []string{"available"},
-			Refresh:    replicationGroupStateRefreshFunc(conn, d.Id(), "available", pending),
-			Timeout:    10 * time.Minute,
-			Delay:      5 * time.Second,
+			Pending:    []string{"creating", "available", "deleting", "create-failed", "incompatible-parameters", "incompatible-network", "restore-failed"},
+			Target:     []string{},
+			Refresh:    cacheClusterStateRefreshFunc(ctx, conn, *id),
+			Timeout:    timeout,
+			Delay:      10 * time.Second,
 			MinTimeout: 3 * time.Second,
 		}
+		if _, sterr := waitForState(ctx, stateConf, "the cache cluster"); sterr != nil {
+			return fmt.Errorf("Error waiting for elasticache cache cluster (%s) to delete: %s", *id, sterr)
+		}
+	}
+
+	return nil
+}
 
-		_, sterr := stateConf.WaitForState()
-		if sterr != nil {
-			return fmt.Errorf("Error waiting for elasticache (%s) to update: %s", d.Id(), sterr)
+func cacheClusterStateRefreshFunc(ctx context.Context, conn *elasticache.ElastiCache, clusterID string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		res, err := conn.DescribeCacheClustersWithContext(ctx, &elasticache.DescribeCacheClustersInput{
+			CacheClusterId:    aws.String(clusterID),
+			ShowCacheNodeInfo: aws.Bool(true),
+		})
+		if err != nil {
+			if isAWSErr(err, "CacheClusterNotFound", "") {
+				return nil, "", nil
+			}
+			return nil, "", err
+		}
+
+		if len(res.CacheClusters) == 0 {
+			return nil, "", nil
 		}
+
+		c := res.CacheClusters[0]
+		log.Printf("[DEBUG] ElastiCache Cache Cluster (%s) status: %v", clusterID, *c.CacheClusterStatus)
+		return c, *c.CacheClusterStatus, nil
 	}
+}
 
-	return resourceAwsElasticacheReplictaionGroupRead(d, meta)
+// Right after CreateReplicationGroup the new group
+// may not be visible to the Describe calls yet.
+const replicationGroupCreateGracePeriod = 1 * time.Minute
+
+// creatingGracePeriodRefreshFunc reports a group that can't be found as
+// still "creating" during the grace period after the wait has started.
+func creatingGracePeriodRefreshFunc(f resource.StateRefreshFunc, replGroupID string, grace time.Duration) resource.StateRefreshFunc {
+	deadline := time.Now().Add(grace)
+	return func() (interface{}, string, error) {
+		result, state, err := f()
+		if err == nil && result == nil && time.Now().Before(deadline) {
+			log.Printf("[DEBUG] ElastiCache Replication Group (%s) isn't visible yet, assuming it is still creating", replGroupID)
+			return replGroupID, "creating", nil
+		}
+		return result, state, err
+	}
 }
 
-func replicationGroupStateRefreshFunc(conn *elasticache.ElastiCache, replGroupID, givenState string, pending []string) resource.StateRefreshFunc {
+func replicationGroupStateRefreshFunc(ctx context.Context, conn *elasticache.ElastiCache, replGroupID, givenState string, pending []string) resource.StateRefreshFunc {
 	return func() (interface{}, string, error) {
-		resp, err := conn.DescribeReplicationGroups(&elasticache.DescribeReplicationGroupsInput{
+		resp, err := conn.DescribeReplicationGroupsWithContext(ctx, &elasticache.DescribeReplicationGroupsInput{
 			ReplicationGroupId: aws.String(replGroupID),
 		})
 		if err != nil {
-			apierr := err.(awserr.Error)
-			log.Printf("[DEBUG] message: %v, code: %v", apierr.Message(), apierr.Code())
-			if apierr.Message() == fmt.Sprintf("ReplicationGroup %v not found.", replGroupID) {
-				log.Printf("[DEBUG] Detect deletion")
+			if isAWSErr(err, "ReplicationGroupNotFoundFault", "") {
+				log.Printf("[DEBUG] ElastiCache Replication Group (%s) not found", replGroupID)
 				return nil, "", nil
 			}
 
@@ -719,3 +1803,47 @@ func replicationGroupStateRefreshFunc(conn *elasticache.ElastiCache, replGroupID
 		return rg, *rg.Status, nil
 	}
 }
+
+// isReplicationGroupBusyErr reports whether a request has been rejected
+// because another operation, e.g. a backup or a maintenance, is running.
+func isReplicationGroupBusyErr(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "InvalidReplicationGroupState" || awsErr.Code() == "InvalidCacheClusterState"
+	}
+	return false
+}
+
+// retryWhileReplicationGroupBusy calls f (ModifyReplicationGroup,
+// CreateCacheCluster, DeleteReplicationGroup, etc.) until it is no
+// longer rejected because of another operation in progress, waiting
+// for the replication group to become available between attempts.
+// The retries are bounded by the deadline of the whole operation, so
+// that whatever the caller waits for afterwards gets only what's left.
+func retryWhileReplicationGroupBusy(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string, deadline time.Time, f func() error) error {
+	for {
+		err := f()
+		if err == nil || !isReplicationGroupBusyErr(err) {
+			return err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return err
+		}
+
+		log.Printf("[INFO] ElastiCache Replication Group (%s) is busy, waiting for it to become available: %s", replGroupID, err)
+		pending := []string{"creating", "modifying", "snapshotting"}
+		stateConf := &resource.StateChangeConf{
+			Pending:    pending,
+			Target:     []string{"available"},
+			Refresh:    replicationGroupStateRefreshFunc(ctx, conn, replGroupID, "available", pending),
+			Timeout:    remaining,
+			Delay:      10 * time.Second, // also keeps us from hammering the API on a busy member cluster
+			MinTimeout: 3 * time.Second,
+		}
+
+		if _, sterr := waitForState(ctx, stateConf, "the replication group"); sterr != nil {
+			return fmt.Errorf("%s (gave up waiting for the replication group to become available: %s)", err, sterr)
+		}
+	}
+}
@@ -1,14 +1,21 @@
 package awsx
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/elasticache"
 
 	terr_aws "github.com/hashicorp/terraform/builtin/providers/aws"
@@ -24,15 +31,16 @@ var builtinAws *schema.Provider
 
 func init() {
 	builtinAws = terr_aws.Provider().(*schema.Provider)
-	testAccProvider = Provider().(*schema.Provider)
+	provider := Provider().(*replacingProvider)
+	testAccProvider = provider.Provider
 	testAccProviders = map[string]terraform.ResourceProvider{
 		"aws":  builtinAws,
-		"awsx": testAccProvider,
+		"awsx": provider,
 	}
 }
 
 func TestProvider(t *testing.T) {
-	if err := Provider().(*schema.Provider).InternalValidate(); err != nil {
+	if err := Provider().(*replacingProvider).InternalValidate(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 }
@@ -41,6 +49,33 @@ func TestProvider_impl(t *testing.T) {
 	var _ terraform.ResourceProvider = Provider()
 }
 
+// testFakeElasticacheConn returns a client talking to a local
+// fake of the ElastiCache API listening on url.
+func testFakeElasticacheConn(url string) *elasticache.ElastiCache {
+	return elasticache.New(session.New(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(url),
+		MaxRetries:  aws.Int(0),
+	}))
+}
+
+// testReplicationGroupUpdate runs f as the Update of the replication
+// group in the given state, with the attributes changed to the new values.
+func testReplicationGroupUpdate(state, changed map[string]string, f func(*schema.ResourceData) error) error {
+	r := resourceAwsElasticacheReplicationGroup()
+	r.Update = func(d *schema.ResourceData, meta interface{}) error {
+		return f(d)
+	}
+
+	diff := &terraform.InstanceDiff{Attributes: map[string]*terraform.ResourceAttrDiff{}}
+	for k, v := range changed {
+		diff.Attributes[k] = &terraform.ResourceAttrDiff{Old: state[k], New: v}
+	}
+	_, err := r.Apply(&terraform.InstanceState{ID: state["replication_group_id"], Attributes: state}, diff, nil)
+	return err
+}
+
 func testAccPreCheck(t *testing.T) {
 	if v := os.Getenv("AWS_ACCESS_KEY_ID"); v == "" {
 		t.Fatal("AWS_ACCESS_KEY_ID must be set for acceptance tests")
@@ -89,6 +124,331 @@ func TestAccAWSElasticacheReplicationGroup_failoverInVPC(t *testing.T) {
 	})
 }
 
+func TestValidateReplicationGroupMultiAZ(t *testing.T) {
+	cases := []struct {
+		Raw      map[string]interface{}
+		ErrCount int
+	}{
+		{
+			Raw: map[string]interface{}{
+				"multi_az_enabled":   true,
+				"automatic_failover": "enabled",
+				"num_cache_clusters": 2,
+				"availability_zones": []interface{}{"eu-west-1a", "eu-west-1b"},
+			},
+			ErrCount: 0,
+		},
+		{
+			Raw: map[string]interface{}{
+				"multi_az_enabled":   true,
+				"automatic_failover": "disabled",
+				"num_cache_clusters": 2,
+			},
+			ErrCount: 1,
+		},
+		{
+			Raw: map[string]interface{}{
+				"multi_az_enabled":   true,
+				"automatic_failover": "enabled",
+				"num_cache_clusters": 1,
+			},
+			ErrCount: 1,
+		},
+		{
+			Raw: map[string]interface{}{
+				"multi_az_enabled":   true,
+				"automatic_failover": "enabled",
+				"num_cache_clusters": 2,
+				"availability_zones": []interface{}{"eu-west-1a"},
+			},
+			ErrCount: 1,
+		},
+		{
+			Raw: map[string]interface{}{
+				"multi_az_enabled":   false,
+				"num_cache_clusters": 1,
+			},
+			ErrCount: 0,
+		},
+	}
+
+	resourceSchema := resourceAwsElasticacheReplicationGroup().Schema
+	for i, tc := range cases {
+		d := schema.TestResourceDataRaw(t, resourceSchema, tc.Raw)
+		err := validateReplicationGroupMultiAZ(d)
+		if (err != nil) != (tc.ErrCount > 0) {
+			t.Fatalf("case %d: unexpected result: %v", i, err)
+		}
+	}
+}
+
+func TestAutoSnapshottingCluster(t *testing.T) {
+	member := func(id, role string) *elasticache.NodeGroupMember {
+		return &elasticache.NodeGroupMember{
+			CacheClusterId: aws.String(id),
+			CurrentRole:    aws.String(role),
+		}
+	}
+	members := []*elasticache.NodeGroupMember{
+		member("tf-test-001", "primary"),
+		member("tf-test-003", "replica"),
+		member("tf-test-002", "replica"),
+	}
+
+	cases := []struct {
+		Current  string
+		Members  []*elasticache.NodeGroupMember
+		Expected string
+	}{
+		// the current one is still a replica
+		{"tf-test-002", members, "tf-test-002"},
+		// the current one has become primary
+		{"tf-test-001", members, "tf-test-003"},
+		// the current one has been removed
+		{"tf-test-004", members, "tf-test-003"},
+		{"", members, "tf-test-003"},
+		// no replicas to choose from
+		{"", members[:1], "tf-test-001"},
+		{"", nil, ""},
+	}
+
+	for i, tc := range cases {
+		if actual := autoSnapshottingCluster(tc.Current, tc.Members); actual != tc.Expected {
+			t.Fatalf("case %d: expected %q, got %q", i, tc.Expected, actual)
+		}
+	}
+}
+
+func TestDivergedAttributes(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceAwsElasticacheReplicationGroup().Schema, map[string]interface{}{
+		"node_type":                "cache.m3.medium",
+		"parameter_group_name":     "default.redis3.2",
+		"snapshot_retention_limit": 1,
+	})
+
+	expected := map[string]interface{}{
+		"node_type":                "cache.m3.large",
+		"parameter_group_name":     "default.redis3.2",
+		"snapshot_retention_limit": 1,
+	}
+	diverged := divergedAttributes(d, expected)
+	if len(diverged) != 1 || diverged[0] != `node_type ("cache.m3.medium", expected "cache.m3.large")` {
+		t.Fatalf("unexpected diverged attributes: %v", diverged)
+	}
+
+	d.Set("node_type", "cache.m3.large")
+	if diverged := divergedAttributes(d, expected); len(diverged) != 0 {
+		t.Fatalf("expected everything to converge, got %v", diverged)
+	}
+}
+
+func TestConvergingValues(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceAwsElasticacheReplicationGroup().Schema, map[string]interface{}{
+		"node_type":          "cache.m3.medium",
+		"maintenance_window": "SUN:05:00-SUN:09:00",
+	})
+
+	expected := convergingValues(d, []string{"node_type", "maintenance_window"})
+	if expected["node_type"] != "cache.m3.medium" || expected["maintenance_window"] != "sun:05:00-sun:09:00" {
+		t.Fatalf("unexpected values: %v", expected)
+	}
+
+	d.Set("maintenance_window", "sun:05:00-sun:09:00")
+	if diverged := divergedAttributes(d, expected); len(diverged) != 0 {
+		t.Fatalf("expected maintenance_window to converge, got %v", diverged)
+	}
+}
+
+func TestReplicationGroupStateRefreshFunc_notFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>ReplicationGroupNotFoundFault</Code>`+
+			`<Message>Replication group tf-test not found</Message></Error></ErrorResponse>`)
+	}))
+	defer srv.Close()
+
+	f := replicationGroupStateRefreshFunc(context.Background(), testFakeElasticacheConn(srv.URL), "tf-test", "available", []string{"creating"})
+	result, state, err := f()
+	if err != nil || result != nil || state != "" {
+		t.Fatalf("expected the group to be reported as gone, got %v, %q, %v", result, state, err)
+	}
+
+	_, state, err = creatingGracePeriodRefreshFunc(f, "tf-test", time.Minute)()
+	if err != nil || state != "creating" {
+		t.Fatalf("expected the group to be creating during the grace period, got %q, %v", state, err)
+	}
+
+	result, _, err = creatingGracePeriodRefreshFunc(f, "tf-test", 0)()
+	if err != nil || result != nil {
+		t.Fatalf("expected the group to be gone after the grace period, got %v, %v", result, err)
+	}
+}
+
+func TestDescribeReplicationGroup_canceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request after the context is canceled")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := describeReplicationGroup(ctx, testFakeElasticacheConn(srv.URL), "tf-test"); !isAWSErr(err, request.CanceledErrorCode, "") {
+		t.Fatalf("expected the request to be canceled, got %v", err)
+	}
+}
+
+func TestInterruptedReplicationGroupCreation(t *testing.T) {
+	req := &elasticache.CreateReplicationGroupInput{
+		ReplicationGroupId:          aws.String("tf-test"),
+		ReplicationGroupDescription: aws.String(""),
+		CacheNodeType:               aws.String("cache.m3.medium"),
+	}
+	token := replicationGroupCreateToken(req)
+	req.Tags = []*elasticache.Tag{{Key: aws.String(replicationGroupCreateTokenTag), Value: aws.String(token)}}
+
+	var tagged string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Form.Get("Action") {
+		case "DescribeReplicationGroups":
+			fmt.Fprint(w, `<DescribeReplicationGroupsResponse><DescribeReplicationGroupsResult><ReplicationGroups>
+  <ReplicationGroup><ReplicationGroupId>tf-test</ReplicationGroupId><Status>creating</Status>
+    <ARN>arn:aws:elasticache:us-west-2:123456789012:replicationgroup:tf-test</ARN></ReplicationGroup>
+</ReplicationGroups></DescribeReplicationGroupsResult></DescribeReplicationGroupsResponse>`)
+		case "ListTagsForResource":
+			fmt.Fprintf(w, `<ListTagsForResourceResponse><ListTagsForResourceResult><TagList>%s</TagList>
+</ListTagsForResourceResult></ListTagsForResourceResponse>`, tagged)
+		}
+	}))
+	defer srv.Close()
+
+	conn := testFakeElasticacheConn(srv.URL)
+	exists := awserr.New("ReplicationGroupAlreadyExists", "Replication group tf-test already exists", nil)
+
+	if rg := interruptedReplicationGroupCreation(context.Background(), conn, req, time.Hour, exists); rg != nil {
+		t.Fatalf("expected an untagged group to be left alone, got %v", rg)
+	}
+
+	tagged = fmt.Sprintf(`<Tag><Key>%s</Key><Value>other</Value></Tag>`, replicationGroupCreateTokenTag)
+	if rg := interruptedReplicationGroupCreation(context.Background(), conn, req, time.Hour, exists); rg != nil {
+		t.Fatalf("expected a group created by another request to be left alone, got %v", rg)
+	}
+
+	tagged = fmt.Sprintf(`<Tag><Key>%s</Key><Value>%s</Value></Tag>`, replicationGroupCreateTokenTag, token)
+	if rg := interruptedReplicationGroupCreation(context.Background(), conn, req, time.Hour, exists); rg == nil {
+		t.Fatalf("expected the group left behind by the same request to be taken over")
+	}
+
+	if rg := interruptedReplicationGroupCreation(context.Background(), conn, req, time.Hour, fmt.Errorf("throttled")); rg != nil {
+		t.Fatalf("expected other errors not to be taken for an interrupted create, got %v", rg)
+	}
+}
+
+func TestReplicationGroupCreateToken(t *testing.T) {
+	req := &elasticache.CreateReplicationGroupInput{
+		ReplicationGroupId: aws.String("tf-test"),
+		CacheNodeType:      aws.String("cache.m3.medium"),
+	}
+	token := replicationGroupCreateToken(req)
+
+	req.Tags = []*elasticache.Tag{{Key: aws.String(replicationGroupCreateTokenTag), Value: aws.String(token)}}
+	if replicationGroupCreateToken(req) != token {
+		t.Fatalf("expected the token to ignore the tags")
+	}
+
+	req.CacheNodeType = aws.String("cache.m3.large")
+	if replicationGroupCreateToken(req) == token {
+		t.Fatalf("expected a different request to get a different token")
+	}
+}
+
+func TestResourceAwsElasticacheReplicationGroupDelete_deletionProtection(t *testing.T) {
+	d := resourceAwsElasticacheReplicationGroup().Data(&terraform.InstanceState{
+		ID: "tf-test",
+		Attributes: map[string]string{
+			"replication_group_id": "tf-test",
+			"deletion_protection":  "true",
+		},
+	})
+
+	// No client is needed, the group must be refused before any call
+	err := resourceAwsElasticacheReplictaionGroupDelete(d, &AWSClient{stopCtx: context.Background()})
+	if err == nil || !strings.Contains(err.Error(), "deletion_protection enabled") {
+		t.Fatalf("expected the deletion to be refused, got %v", err)
+	}
+	if d.Id() != "tf-test" {
+		t.Fatalf("expected the group to stay in the state, got %q", d.Id())
+	}
+}
+
+func TestOnCreateFailureAction(t *testing.T) {
+	cases := []struct {
+		onFailure string
+		attempt   int
+		status    string
+		remove    bool
+		retry     bool
+	}{
+		{"keep", 1, "create-failed", false, false},
+		{"delete", 1, "create-failed", true, false},
+		{"delete", 1, "creating", false, false},
+		{"delete", 1, "available", false, false},
+		{"retry", 1, "create-failed", true, true},
+		{"retry", 2, "create-failed", true, false},
+		{"retry", 1, "creating", false, false},
+	}
+
+	for _, c := range cases {
+		remove, retry := onCreateFailureAction(c.onFailure, c.attempt, c.status)
+		if remove != c.remove || retry != c.retry {
+			t.Errorf("%s, attempt %d, %s: expected remove %t, retry %t, got %t, %t",
+				c.onFailure, c.attempt, c.status, c.remove, c.retry, remove, retry)
+		}
+	}
+}
+
+func TestRetryWhileReplicationGroupBusy_deadline(t *testing.T) {
+	busy := awserr.New("InvalidReplicationGroupState", "Replication group tf-test is not available", nil)
+	calls := 0
+
+	start := time.Now()
+	err := retryWhileReplicationGroupBusy(context.Background(), nil, "tf-test", start.Add(-time.Second), func() error {
+		calls++
+		return busy
+	})
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected the spent deadline to end the retries at once, it took %s", time.Since(start))
+	}
+	if err != busy || calls != 1 {
+		t.Fatalf("expected the busy error after a single call, got %v after %d calls", err, calls)
+	}
+}
+
+func TestReplicationGroupMultiAZ(t *testing.T) {
+	cases := []struct {
+		multiAZ, multiAZChanged, failover, failoverChanged bool
+		expected, expectedChanged                          bool
+	}{
+		// Read found Multi-AZ on, automatic failover is being disabled
+		{true, false, false, true, false, true},
+		// Multi-AZ is being turned off along with it
+		{false, true, false, true, false, true},
+		// Only Multi-AZ is changing
+		{true, true, true, false, true, true},
+		// Automatic failover is being enabled
+		{false, false, true, true, false, false},
+		// Nothing to do
+		{true, false, true, false, true, false},
+	}
+
+	for i, c := range cases {
+		v, changed := replicationGroupMultiAZ(c.multiAZ, c.multiAZChanged, c.failover, c.failoverChanged)
+		if v != c.expected || changed != c.expectedChanged {
+			t.Errorf("case %d: expected %t, %t, got %t, %t", i, c.expected, c.expectedChanged, v, changed)
+		}
+	}
+}
+
 func TestAccAWSElasticacheReplicationGroup_snapshotsWithUpdates(t *testing.T) {
 	var rg elasticache.ReplicationGroup
 
@@ -141,7 +501,7 @@ func testAccCheckAWSElasticacheReplicationGroupExists(n string, v *elasticache.R
 			return fmt.Errorf("No cache cluster ID is set")
 		}
 
-		conn := testAccProvider.Meta().(*elasticache.ElastiCache)
+		conn := testAccProvider.Meta().(*AWSClient).elasticacheconn
 		resp, err := conn.DescribeReplicationGroups(&elasticache.DescribeReplicationGroupsInput{
 			ReplicationGroupId: aws.String(rs.Primary.ID),
 		})
@@ -182,7 +542,7 @@ func testAccCheckAWSElasticacheReplicationGroupAvailabilityZones(zones []string,
 }
 
 func testAccCheckAWSElasticacheReplicationGroupDestroy(s *terraform.State) error {
-	conn := testAccProvider.Meta().(*elasticache.ElastiCache)
+	conn := testAccProvider.Meta().(*AWSClient).elasticacheconn
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "awsx_elasticache_replication_group" {
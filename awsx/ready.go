@@ -0,0 +1,290 @@
+package awsx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Applies to a single connection attempt, not to the whole wait
+const readyCheckDialTimeout = 5 * time.Second
+
+func waitForReadySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"timeout": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  "5m",
+					ValidateFunc: func(v interface{}, k string) (ws []string, es []error) {
+						if _, err := time.ParseDuration(v.(string)); err != nil {
+							es = append(es, fmt.Errorf("%q is not a valid duration: %s", k, err))
+						}
+						return
+					},
+				},
+				"tls": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  false,
+				},
+				"auth_token": &schema.Schema{
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				// Only used together with auth_token
+				"username": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"check_replicas": &schema.Schema{
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  true,
+				},
+			},
+		},
+	}
+}
+
+type readyCheck struct {
+	timeout       time.Duration
+	tls           bool
+	authToken     string
+	username      string
+	checkReplicas bool
+}
+
+// expandReadyCheck returns nil when wait_for_ready isn't configured.
+func expandReadyCheck(configured []interface{}) *readyCheck {
+	if len(configured) == 0 || configured[0] == nil {
+		return nil
+	}
+	m := configured[0].(map[string]interface{})
+	timeout, _ := time.ParseDuration(m["timeout"].(string))
+	return &readyCheck{
+		timeout:       timeout,
+		tls:           m["tls"].(bool),
+		authToken:     m["auth_token"].(string),
+		username:      m["username"].(string),
+		checkReplicas: m["check_replicas"].(bool),
+	}
+}
+
+// waitForReplicationGroupReady goes beyond the group being "available"
+// and waits until its primary endpoint answers PING and, optionally,
+// every replica reports an established link to the primary.
+// It relies on the endpoint and the nodes being read into the state.
+func waitForReplicationGroupReady(ctx context.Context, d *schema.ResourceData) error {
+	c := expandReadyCheck(d.Get("wait_for_ready").([]interface{}))
+	if c == nil {
+		return nil
+	}
+
+	endpoint := d.Get("endpoint_address").(string)
+	if endpoint == "" {
+		return fmt.Errorf("Can't wait for elasticache (%s) to become ready, it has no primary endpoint", d.Id())
+	}
+	primary := net.JoinHostPort(endpoint, strconv.Itoa(d.Get("port").(int)))
+
+	var replicas []string
+	if c.checkReplicas {
+		for _, v := range d.Get("cache_nodes").([]interface{}) {
+			node := v.(map[string]interface{})
+			if node["role"].(string) == "replica" {
+				replicas = append(replicas, net.JoinHostPort(node["address"].(string), strconv.Itoa(node["port"].(int))))
+			}
+		}
+	}
+
+	log.Printf("[DEBUG] Waiting for elasticache (%s) to become ready: primary %s, replicas %v", d.Id(), primary, replicas)
+	err := retry(ctx, c.timeout, func() *resource.RetryError {
+		if err := c.checkPrimary(primary); err != nil {
+			return resource.RetryableError(err)
+		}
+		for _, addr := range replicas {
+			if err := c.checkReplica(addr); err != nil {
+				return resource.RetryableError(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error waiting for elasticache (%s) to become ready: %s", d.Id(), err)
+	}
+	return nil
+}
+
+func (c *readyCheck) checkPrimary(addr string) error {
+	conn, err := c.dial(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reply, err := conn.do("PING")
+	if err != nil {
+		return fmt.Errorf("%s: %s", addr, err)
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%s: unexpected reply to PING: %v", addr, reply)
+	}
+	return nil
+}
+
+func (c *readyCheck) checkReplica(addr string) error {
+	conn, err := c.dial(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reply, err := conn.do("INFO", "replication")
+	if err != nil {
+		return fmt.Errorf("%s: %s", addr, err)
+	}
+	info, ok := reply.(string)
+	if !ok {
+		return fmt.Errorf("%s: unexpected reply to INFO: %v", addr, reply)
+	}
+	if status := redisInfoField(info, "master_link_status"); status != "up" {
+		return fmt.Errorf("%s: replica link to the primary is %q", addr, status)
+	}
+	return nil
+}
+
+// dial connects and authenticates, if an auth token is configured.
+func (c *readyCheck) dial(addr string) (*respConn, error) {
+	dialer := &net.Dialer{Timeout: readyCheckDialTimeout}
+	var conn net.Conn
+	var err error
+	if c.tls {
+		host, _, _ := net.SplitHostPort(addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(readyCheckDialTimeout))
+
+	rc := &respConn{conn: conn, r: bufio.NewReader(conn)}
+	if c.authToken == "" {
+		return rc, nil
+	}
+
+	args := []string{"AUTH", c.authToken}
+	if c.username != "" {
+		args = []string{"AUTH", c.username, c.authToken}
+	}
+	if _, err := rc.do(args...); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("%s: AUTH failed: %s", addr, err)
+	}
+	return rc, nil
+}
+
+// respConn is just enough of a RESP client to run the readiness checks.
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *respConn) Close() error {
+	return c.conn.Close()
+}
+
+// do sends a command and returns its reply: a string for simple and
+// bulk strings, an int64 for integers, a []interface{} for arrays and
+// nil for nulls. Error replies are returned as errors.
+func (c *respConn) do(args ...string) (interface{}, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return readRESP(c.r)
+}
+
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed RESP line %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, fmt.Errorf("%s", payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed RESP bulk length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed RESP array length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := readRESP(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown RESP type %q", kind)
+}
+
+// redisInfoField extracts a field from the output of INFO,
+// which consists of "field:value" lines and "# Section" headers.
+func redisInfoField(info, field string) string {
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, field+":") {
+			return line[len(field)+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,213 @@
+package awsx
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// fakeRedis answers PING, AUTH and INFO replication the way
+// a primary or a replica of an ElastiCache group would.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu         sync.Mutex
+	linkStatus string // empty for a primary
+	commands   []string
+}
+
+func newFakeRedis(t *testing.T, password, linkStatus string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{listener: l, password: password, linkStatus: linkStatus}
+	go s.serve()
+	return s
+}
+
+func (s *fakeRedis) addr() (string, int) {
+	a := s.listener.Addr().(*net.TCPAddr)
+	return a.IP.String(), a.Port
+}
+
+func (s *fakeRedis) setLinkStatus(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.linkStatus = status
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	for {
+		v, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range v.([]interface{}) {
+			args = append(args, a.(string))
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		linkStatus := s.linkStatus
+		s.mu.Unlock()
+
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			if args[len(args)-1] != s.password {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+				break
+			}
+			authenticated = true
+			reply = "+OK\r\n"
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "PING":
+			reply = "+PONG\r\n"
+		case args[0] == "INFO":
+			info := "# Replication\r\nrole:master\r\nconnected_slaves:1\r\n"
+			if linkStatus != "" {
+				info = fmt.Sprintf("# Replication\r\nrole:slave\r\nmaster_link_status:%s\r\n", linkStatus)
+			}
+			reply = "$" + strconv.Itoa(len(info)) + "\r\n" + info + "\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		conn.Write([]byte(reply))
+	}
+}
+
+func TestReadRESP(t *testing.T) {
+	input := "+OK\r\n:42\r\n$5\r\nhello\r\n$-1\r\n*2\r\n$3\r\nfoo\r\n:1\r\n-ERR boom\r\n"
+	r := bufio.NewReader(strings.NewReader(input))
+
+	expected := []interface{}{"OK", int64(42), "hello", nil}
+	for _, e := range expected {
+		v, err := readRESP(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != e {
+			t.Fatalf("expected %#v, got %#v", e, v)
+		}
+	}
+
+	v, err := readRESP(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := v.([]interface{}); len(items) != 2 || items[0] != "foo" || items[1] != int64(1) {
+		t.Fatalf("unexpected array: %#v", v)
+	}
+
+	if _, err := readRESP(r); err == nil || err.Error() != "ERR boom" {
+		t.Fatalf("expected the error reply, got %v", err)
+	}
+}
+
+func TestRedisInfoField(t *testing.T) {
+	info := "# Replication\r\nrole:slave\r\nmaster_host:10.0.0.1\r\nmaster_link_status:up\r\n"
+	if v := redisInfoField(info, "master_link_status"); v != "up" {
+		t.Fatalf("expected up, got %q", v)
+	}
+	if v := redisInfoField(info, "master_sync_in_progress"); v != "" {
+		t.Fatalf("expected nothing, got %q", v)
+	}
+}
+
+func TestReadyCheck(t *testing.T) {
+	primary := newFakeRedis(t, "secret", "")
+	defer primary.listener.Close()
+	replica := newFakeRedis(t, "secret", "down")
+	defer replica.listener.Close()
+
+	host, port := primary.addr()
+	primaryAddr := net.JoinHostPort(host, strconv.Itoa(port))
+	host, port = replica.addr()
+	replicaAddr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	c := &readyCheck{authToken: "wrong"}
+	if err := c.checkPrimary(primaryAddr); err == nil || !strings.Contains(err.Error(), "AUTH failed") {
+		t.Fatalf("expected AUTH to fail, got %v", err)
+	}
+
+	c = &readyCheck{}
+	if err := c.checkPrimary(primaryAddr); err == nil {
+		t.Fatal("expected PING to be refused without AUTH")
+	}
+
+	c = &readyCheck{authToken: "secret", username: "default"}
+	if err := c.checkPrimary(primaryAddr); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.checkReplica(replicaAddr); err == nil || !strings.Contains(err.Error(), `"down"`) {
+		t.Fatalf("expected the replica link to be down, got %v", err)
+	}
+
+	replica.setLinkStatus("up")
+	if err := c.checkReplica(replicaAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	if last := primary.commands[len(primary.commands)-2]; last != "AUTH default secret" {
+		t.Fatalf("expected AUTH with the username, got %q", last)
+	}
+}
+
+func TestWaitForReplicationGroupReady(t *testing.T) {
+	primary := newFakeRedis(t, "", "")
+	defer primary.listener.Close()
+	replica := newFakeRedis(t, "", "up")
+	defer replica.listener.Close()
+
+	host, port := primary.addr()
+	replicaHost, replicaPort := replica.addr()
+
+	d := schema.TestResourceDataRaw(t, resourceAwsElasticacheReplicationGroup().Schema, map[string]interface{}{
+		"port": port,
+		"wait_for_ready": []interface{}{
+			map[string]interface{}{"timeout": "10s"},
+		},
+	})
+	d.SetId("tf-test")
+	d.Set("endpoint_address", host)
+	d.Set("cache_nodes", []map[string]interface{}{
+		{"id": "tf-test-001", "role": "primary", "address": host, "port": port},
+		{"id": "tf-test-002", "role": "replica", "address": replicaHost, "port": replicaPort},
+	})
+
+	if err := waitForReplicationGroupReady(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+	if len(replica.commands) != 1 || replica.commands[0] != "INFO replication" {
+		t.Fatalf("expected the replica to be checked once, got %v", replica.commands)
+	}
+}
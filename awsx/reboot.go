@@ -0,0 +1,157 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+const parameterApplyStatusPendingReboot = "pending-reboot"
+
+// A rebooted cluster may still report itself available with parameters
+// pending a reboot until the reboot gets under way.
+const memberRebootStartGracePeriod = 2 * time.Minute
+
+// replicationGroupParameterApplyStatus sums up the parameter apply
+// statuses of the members: pending-reboot if any member needs a reboot,
+// otherwise the status of the first member that isn't in sync.
+func replicationGroupParameterApplyStatus(ids []string, clusters map[string]*elasticache.CacheCluster) string {
+	var status string
+	for _, id := range ids {
+		s := memberParameterApplyStatus(clusters[id])
+		if s == "" {
+			continue
+		}
+		if s == parameterApplyStatusPendingReboot {
+			return s
+		}
+		if status == "" || status == "in-sync" {
+			status = s
+		}
+	}
+	return status
+}
+
+// memberParameterApplyStatus returns "" for a member that
+// can't be described or has no parameter group.
+func memberParameterApplyStatus(c *elasticache.CacheCluster) string {
+	if c == nil || c.CacheParameterGroup == nil {
+		return ""
+	}
+	return aws.StringValue(c.CacheParameterGroup.ParameterApplyStatus)
+}
+
+// memberRebootOrder orders the members for a rolling reboot:
+// replicas first, the primary last.
+func memberRebootOrder(members []*elasticache.NodeGroupMember) []string {
+	var replicas, primaries []string
+	for _, m := range members {
+		if aws.StringValue(m.CurrentRole) == "primary" {
+			primaries = append(primaries, *m.CacheClusterId)
+		} else {
+			replicas = append(replicas, *m.CacheClusterId)
+		}
+	}
+	sort.Strings(replicas)
+	return append(replicas, primaries...)
+}
+
+// rebootReplicationGroupMembers reboots the members that have parameters
+// pending a reboot one at a time, in the order of memberRebootOrder,
+// so that the group keeps serving while the parameters are applied.
+// The timeout covers all the reboots, not each of them.
+func rebootReplicationGroupMembers(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	rg, err := describeReplicationGroup(ctx, conn, replGroupID)
+	if err != nil {
+		return err
+	}
+	if rg == nil || len(rg.NodeGroups) != 1 {
+		return fmt.Errorf("Error rebooting elasticache (%s): the replication group is not found", replGroupID)
+	}
+
+	order := memberRebootOrder(rg.NodeGroups[0].NodeGroupMembers)
+	clusters, err := describeMemberClusters(ctx, conn, order, memberClusterDescribeConcurrency)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		c := clusters[id]
+		if c == nil || c.CacheParameterGroup == nil ||
+			aws.StringValue(c.CacheParameterGroup.ParameterApplyStatus) != parameterApplyStatusPendingReboot {
+			continue
+		}
+
+		var nodeIds []*string
+		for _, n := range c.CacheNodes {
+			nodeIds = append(nodeIds, n.CacheNodeId)
+		}
+
+		log.Printf("[INFO] Rebooting ElastiCache Cache Cluster (%s) to apply parameters", id)
+		_, err := conn.RebootCacheClusterWithContext(ctx, &elasticache.RebootCacheClusterInput{
+			CacheClusterId:       aws.String(id),
+			CacheNodeIdsToReboot: nodeIds,
+		})
+		if err != nil {
+			return fmt.Errorf("Error rebooting elasticache cache cluster (%s): %s", id, err)
+		}
+
+		stateConf := &resource.StateChangeConf{
+			Pending:    []string{"available", "rebooting cluster nodes", "modifying"},
+			Target:     []string{"rebooted"},
+			Refresh:    memberRebootRefreshFunc(cacheClusterStateRefreshFunc(ctx, conn, id), id, memberRebootStartGracePeriod),
+			Timeout:    time.Until(deadline),
+			Delay:      10 * time.Second,
+			MinTimeout: 3 * time.Second,
+		}
+		if _, err := waitForState(ctx, stateConf, "the cache cluster"); err != nil {
+			return fmt.Errorf("Error waiting for elasticache cache cluster (%s) to reboot: %s", id, err)
+		}
+	}
+
+	return nil
+}
+
+// memberRebootRefreshFunc reports "rebooted" once the cluster is
+// available again and has no parameters pending a reboot anymore.
+// A cluster that is still pending a reboot once it has been through one,
+// or that hasn't started one within the grace period, fails the wait
+// instead of running it into the timeout.
+func memberRebootRefreshFunc(refresh resource.StateRefreshFunc, clusterID string, grace time.Duration) resource.StateRefreshFunc {
+	deadline := time.Now().Add(grace)
+	var rebooting bool
+	return func() (interface{}, string, error) {
+		result, state, err := refresh()
+		if err != nil {
+			return nil, "", err
+		}
+		if result == nil {
+			return nil, "", fmt.Errorf("cache cluster (%s) not found", clusterID)
+		}
+
+		c := result.(*elasticache.CacheCluster)
+		if state != "available" {
+			rebooting = true
+			return c, state, nil
+		}
+		if c.CacheParameterGroup == nil ||
+			aws.StringValue(c.CacheParameterGroup.ParameterApplyStatus) != parameterApplyStatusPendingReboot {
+			return c, "rebooted", nil
+		}
+		if rebooting {
+			return nil, "", fmt.Errorf("cache cluster (%s) is available again, but its parameters are still pending a reboot", clusterID)
+		}
+		if time.Now().After(deadline) {
+			return nil, "", fmt.Errorf("cache cluster (%s) hasn't started rebooting within %s", clusterID, grace)
+		}
+		return c, state, nil
+	}
+}
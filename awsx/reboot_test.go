@@ -0,0 +1,140 @@
+package awsx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestReplicationGroupParameterApplyStatus(t *testing.T) {
+	cluster := func(status string) *elasticache.CacheCluster {
+		return &elasticache.CacheCluster{
+			CacheParameterGroup: &elasticache.CacheParameterGroupStatus{
+				ParameterApplyStatus: aws.String(status),
+			},
+		}
+	}
+	ids := []string{"tf-test-001", "tf-test-002", "tf-test-003"}
+
+	cases := []struct {
+		Clusters map[string]*elasticache.CacheCluster
+		Expected string
+	}{
+		{map[string]*elasticache.CacheCluster{}, ""},
+		{map[string]*elasticache.CacheCluster{
+			"tf-test-001": cluster("in-sync"),
+			"tf-test-002": cluster("in-sync"),
+		}, "in-sync"},
+		{map[string]*elasticache.CacheCluster{
+			"tf-test-001": cluster("in-sync"),
+			"tf-test-002": cluster("applying"),
+			"tf-test-003": cluster("in-sync"),
+		}, "applying"},
+		{map[string]*elasticache.CacheCluster{
+			"tf-test-001": cluster("applying"),
+			"tf-test-003": cluster("pending-reboot"),
+		}, "pending-reboot"},
+		// The primary isn't necessarily among the first members
+		{map[string]*elasticache.CacheCluster{
+			"tf-test-001": cluster("in-sync"),
+			"tf-test-002": cluster("in-sync"),
+			"tf-test-003": cluster("pending-reboot"),
+		}, "pending-reboot"},
+	}
+
+	for i, tc := range cases {
+		if actual := replicationGroupParameterApplyStatus(ids, tc.Clusters); actual != tc.Expected {
+			t.Fatalf("case %d: expected %q, got %q", i, tc.Expected, actual)
+		}
+	}
+}
+
+func TestMemberRebootOrder(t *testing.T) {
+	member := func(id, role string) *elasticache.NodeGroupMember {
+		return &elasticache.NodeGroupMember{
+			CacheClusterId: aws.String(id),
+			CurrentRole:    aws.String(role),
+		}
+	}
+	order := memberRebootOrder([]*elasticache.NodeGroupMember{
+		member("tf-test-002", "primary"),
+		member("tf-test-003", "replica"),
+		member("tf-test-001", "replica"),
+	})
+
+	if fmt.Sprint(order) != "[tf-test-001 tf-test-003 tf-test-002]" {
+		t.Fatalf("expected the replicas first and the primary last, got %v", order)
+	}
+}
+
+func TestMemberRebootRefreshFunc(t *testing.T) {
+	cluster := func(status, applyStatus string) *elasticache.CacheCluster {
+		return &elasticache.CacheCluster{
+			CacheClusterStatus: aws.String(status),
+			CacheParameterGroup: &elasticache.CacheParameterGroupStatus{
+				ParameterApplyStatus: aws.String(applyStatus),
+			},
+		}
+	}
+	sequence := func(clusters ...*elasticache.CacheCluster) resource.StateRefreshFunc {
+		return func() (interface{}, string, error) {
+			c := clusters[0]
+			if len(clusters) > 1 {
+				clusters = clusters[1:]
+			}
+			return c, *c.CacheClusterStatus, nil
+		}
+	}
+
+	cases := []struct {
+		clusters []*elasticache.CacheCluster
+		grace    time.Duration
+		states   []string
+		err      string
+	}{
+		{
+			clusters: []*elasticache.CacheCluster{
+				cluster("available", "pending-reboot"),
+				cluster("rebooting cluster nodes", "pending-reboot"),
+				cluster("available", "in-sync"),
+			},
+			grace:  time.Minute,
+			states: []string{"available", "rebooting cluster nodes", "rebooted"},
+		},
+		{
+			clusters: []*elasticache.CacheCluster{
+				cluster("rebooting cluster nodes", "pending-reboot"),
+				cluster("available", "pending-reboot"),
+			},
+			grace:  time.Minute,
+			states: []string{"rebooting cluster nodes"},
+			err:    "still pending a reboot",
+		},
+		{
+			clusters: []*elasticache.CacheCluster{
+				cluster("available", "pending-reboot"),
+			},
+			err: "hasn't started rebooting",
+		},
+	}
+
+	for i, c := range cases {
+		f := memberRebootRefreshFunc(sequence(c.clusters...), "tf-test-001", c.grace)
+		for _, expected := range c.states {
+			if _, state, err := f(); err != nil || state != expected {
+				t.Fatalf("%d: expected %q, got %q, %v", i, expected, state, err)
+			}
+		}
+		if c.err == "" {
+			continue
+		}
+		if _, _, err := f(); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%d: expected error %q, got %v", i, c.err, err)
+		}
+	}
+}
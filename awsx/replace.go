@@ -0,0 +1,217 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Attributes ElastiCache can't change in place. A change to any of them
+// forces a new resource, unless replacement_strategy is blue_green and
+// Update replaces the group instead.
+var replicationGroupReplacingAttributes = []string{
+	"port",
+	"subnet_group_name",
+	"security_group_names",
+}
+
+// replacingProvider plans the replacing attributes of a replication group
+// with replacement_strategy = "blue_green" as an update. Terraform 0.9 has
+// no way of making ForceNew depend on the configuration, so such a group
+// is diffed against a copy of the resource without it.
+type replacingProvider struct {
+	*schema.Provider
+	blueGreen *schema.Resource
+}
+
+func newReplacingProvider(p *schema.Provider) *replacingProvider {
+	r := p.ResourcesMap["awsx_elasticache_replication_group"]
+	blueGreen := *r
+	blueGreen.Schema = make(map[string]*schema.Schema, len(r.Schema))
+	for k, s := range r.Schema {
+		blueGreen.Schema[k] = s
+	}
+	for _, k := range replicationGroupReplacingAttributes {
+		s := *r.Schema[k]
+		s.ForceNew = false
+		blueGreen.Schema[k] = &s
+	}
+	return &replacingProvider{Provider: p, blueGreen: &blueGreen}
+}
+
+func (p *replacingProvider) Diff(info *terraform.InstanceInfo, s *terraform.InstanceState, c *terraform.ResourceConfig) (*terraform.InstanceDiff, error) {
+	if info.Type == "awsx_elasticache_replication_group" && s != nil && s.ID != "" {
+		if v, ok := c.Get("replacement_strategy"); ok && v == "blue_green" {
+			return p.blueGreen.Diff(s, c)
+		}
+	}
+	return p.Provider.Diff(info, s, c)
+}
+
+const replicationGroupIDMaxLength = 40
+
+func replicationGroupReplacingChanges(d *schema.ResourceData) []string {
+	var changed []string
+	for _, k := range replicationGroupReplacingAttributes {
+		if d.HasChange(k) {
+			changed = append(changed, k)
+		}
+	}
+	return changed
+}
+
+// blueGreenReplicationGroupID derives the id of a blue/green replacement
+// from the configured one, shortening it to keep within the 40 characters
+// allowed. Later replacements derive their ids from the same configured id.
+func blueGreenReplicationGroupID(configured string, now time.Time) string {
+	suffix := strconv.FormatInt(now.Unix(), 36)
+	return blueGreenReplicationGroupIDBase(configured, len(suffix)) + "-" + suffix
+}
+
+func blueGreenReplicationGroupIDBase(configured string, suffixLen int) string {
+	base := strings.ToLower(configured)
+	if max := replicationGroupIDMaxLength - suffixLen - 1; len(base) > max {
+		base = strings.TrimRight(base[:max], "-")
+	}
+	return base
+}
+
+// isReplicationGroupReplacement tells whether the group id has been
+// derived by blueGreenReplicationGroupID from the configured one.
+func isReplicationGroupReplacement(configured, id string) bool {
+	if configured == "" {
+		return false
+	}
+	i := strings.LastIndex(id, "-")
+	if i < 0 {
+		return false
+	}
+	if _, err := strconv.ParseInt(id[i+1:], 36, 64); err != nil {
+		return false
+	}
+	return id[:i] == blueGreenReplicationGroupIDBase(configured, len(id)-i-1)
+}
+
+func blueGreenSnapshotName(replGroupID string, now time.Time) string {
+	return fmt.Sprintf("%s-blue-green-%d", replGroupID, now.Unix())
+}
+
+// replaceReplicationGroup replaces the group because of a change to the
+// replacing attributes, which replacingProvider only plans as an update
+// with blue_green: the new group is created from a snapshot of the old one
+// under a new id and the old one is deleted only once the new one is
+// ready. Anything else refuses, the change has to force a new resource.
+func replaceReplicationGroup(ctx context.Context, d *schema.ResourceData, meta interface{}, changed []string, timeout time.Duration) error {
+	if d.Get("replacement_strategy").(string) != "blue_green" {
+		return fmt.Errorf("ElastiCache Replication Group (%s) can't change %s in place, "+
+			"taint it to have it destroyed and created again or set replacement_strategy = \"blue_green\"",
+			d.Id(), strings.Join(changed, ", "))
+	}
+
+	// The value comes from the state, as in Delete
+	if o, _ := d.GetChange("deletion_protection"); o.(bool) {
+		return fmt.Errorf("ElastiCache Replication Group (%s) has deletion_protection enabled, "+
+			"it can't be replaced to change %s until deletion_protection is set to false and applied",
+			d.Id(), strings.Join(changed, ", "))
+	}
+	if v := d.Get("global_replication_group_role").(string); v != "" {
+		return fmt.Errorf("ElastiCache Replication Group (%s) is the %s of a Global Datastore "+
+			"and can't be replaced to change %s", d.Id(), v, strings.Join(changed, ", "))
+	}
+
+	log.Printf("[INFO] Replacing ElastiCache Replication Group (%s) to change %s", d.Id(), strings.Join(changed, ", "))
+	if err := blueGreenReplaceReplicationGroup(ctx, d, meta, timeout); err != nil {
+		return err
+	}
+
+	if err := resourceAwsElasticacheReplictaionGroupRead(d, meta); err != nil {
+		return err
+	}
+	return waitForReplicationGroupReady(ctx, d)
+}
+
+// blueGreenReplaceReplicationGroup restores a snapshot of the old group
+// into a new one and switches the resource over to the new group once
+// it is ready. The old group keeps serving until then and is deleted
+// last; the snapshot is kept.
+func blueGreenReplaceReplicationGroup(ctx context.Context, d *schema.ResourceData, meta interface{}, timeout time.Duration) error {
+	client := meta.(*AWSClient)
+	conn := client.elasticacheconn
+	deadline := time.Now().Add(timeout)
+
+	oldID := d.Id()
+	now := time.Now()
+	newID := blueGreenReplicationGroupID(d.Get("replication_group_id").(string), now)
+
+	req, err := replicationGroupCreateInput(ctx, d, conn, newID)
+	if err != nil {
+		return err
+	}
+
+	if err := waitForReplicationGroupOperationInProgress(ctx, conn, oldID, time.Until(deadline)); err != nil {
+		return err
+	}
+
+	snapshotName := blueGreenSnapshotName(oldID, now)
+	log.Printf("[INFO] Taking snapshot (%s) of ElastiCache Replication Group (%s) for its replacement (%s)", snapshotName, oldID, newID)
+	if err := snapshotReplicationGroup(ctx, conn, oldID, snapshotName, time.Until(deadline)); err != nil {
+		return err
+	}
+	req.SnapshotArns = nil
+	req.SnapshotName = &snapshotName
+
+	client.describeCache.invalidate(newID)
+	err = createReplicationGroupOnFailure(ctx, d, conn, req, time.Until(deadline))
+	if err == nil {
+		err = configureCreatedReplicationGroup(ctx, d, conn, req, time.Until(deadline))
+	}
+	if err == nil {
+		err = resourceAwsElasticacheReplictaionGroupRead(d, meta)
+	}
+	if err == nil {
+		err = waitForReplicationGroupReady(ctx, d)
+	}
+	if err != nil {
+		return discardReplicationGroupReplacement(ctx, d, meta, oldID, newID, err)
+	}
+
+	// The new group is the one in use from here on, also if the old one
+	// fails to delete, so the state has to have it along with the
+	// attributes it has been created with.
+	d.Partial(false)
+
+	log.Printf("[INFO] ElastiCache Replication Group (%s) is replaced with (%s), deleting it", oldID, newID)
+	client.describeCache.invalidate(oldID)
+	if err := deleteReplicationGroup(ctx, conn, oldID, time.Until(deadline)); err != nil {
+		return fmt.Errorf("Error deleting elasticache (%s) replaced with (%s), the old group is left behind "+
+			"and has to be deleted by hand: %s", oldID, newID, err)
+	}
+	return nil
+}
+
+// discardReplicationGroupReplacement switches the resource back to the old
+// group after the replacement has failed, deleting the new group if it has
+// been created. The deletion gets the delete timeout, since the failure may
+// well be the update running out of time.
+func discardReplicationGroupReplacement(ctx context.Context, d *schema.ResourceData, meta interface{}, oldID, newID string, cause error) error {
+	client := meta.(*AWSClient)
+	created := d.Id() == newID
+	d.SetId(oldID)
+	if !created {
+		return fmt.Errorf("Error replacing elasticache (%s) with (%s), the old group stays in use: %s", oldID, newID, cause)
+	}
+
+	log.Printf("[WARN] Deleting ElastiCache Replication Group (%s) that failed to replace (%s)", newID, oldID)
+	client.describeCache.invalidate(newID)
+	if err := deleteReplicationGroup(ctx, client.elasticacheconn, newID, d.Timeout(schema.TimeoutDelete)); err != nil {
+		return fmt.Errorf("Error replacing elasticache (%s) with (%s), the old group stays in use: %s\n"+
+			"Error deleting the new group, it has to be deleted by hand: %s", oldID, newID, cause, err)
+	}
+	return fmt.Errorf("Error replacing elasticache (%s) with (%s), the new group is deleted and the old one stays in use: %s", oldID, newID, cause)
+}
@@ -0,0 +1,243 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestBlueGreenReplicationGroupID(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	id := blueGreenReplicationGroupID("Cache", now)
+	if id != "cache-s44we8" {
+		t.Fatalf("unexpected id: %s", id)
+	}
+	if !isReplicationGroupReplacement("Cache", id) {
+		t.Fatalf("expected %s to replace Cache", id)
+	}
+
+	long := "a-very-long-replication-group-name-x-y"
+	id = blueGreenReplicationGroupID(long, now)
+	if len(id) > replicationGroupIDMaxLength || strings.Contains(id, "--") {
+		t.Fatalf("invalid id: %s", id)
+	}
+	if !isReplicationGroupReplacement(long, id) {
+		t.Fatalf("expected %s to replace %s", id, long)
+	}
+}
+
+func TestIsReplicationGroupReplacement(t *testing.T) {
+	cases := []struct {
+		configured, id string
+		expected       bool
+	}{
+		{"cache", "cache", false},
+		{"cache", "cache-s44we8", true},
+		{"cache", "other-s49g4w", false},
+		{"cache-bar", "cache-baz", false},
+		{"", "cache-s44we8", false},
+	}
+	for _, c := range cases {
+		if r := isReplicationGroupReplacement(c.configured, c.id); r != c.expected {
+			t.Errorf("%q, %q: expected %t, got %t", c.configured, c.id, c.expected, r)
+		}
+	}
+}
+
+func TestReplacingProviderDiff(t *testing.T) {
+	state := &terraform.InstanceState{ID: "tf-test", Attributes: testReplaceReplicationGroupState(nil)}
+	cases := []struct {
+		strategy    string
+		requiresNew bool
+	}{
+		{"recreate", true},
+		{"blue_green", false},
+	}
+
+	for _, c := range cases {
+		raw, err := config.NewRawConfig(map[string]interface{}{
+			"replication_group_id": "tf-test",
+			"description":          "test",
+			"node_type":            "cache.m5.large",
+			"num_cache_clusters":   2,
+			"port":                 6380,
+			"replacement_strategy": c.strategy,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		diff, err := Provider().Diff(&terraform.InstanceInfo{Type: "awsx_elasticache_replication_group"}, state, terraform.NewResourceConfig(raw))
+		if err != nil {
+			t.Fatalf("%s: err: %s", c.strategy, err)
+		}
+		if diff.Attributes["port"] == nil || diff.Attributes["port"].New != "6380" {
+			t.Fatalf("%s: expected a port change, got %#v", c.strategy, diff)
+		}
+		if diff.RequiresNew() != c.requiresNew {
+			t.Fatalf("%s: expected requires new %t, got %#v", c.strategy, c.requiresNew, diff)
+		}
+	}
+
+	// The resource itself keeps forcing a new one
+	if !Provider().(*replacingProvider).ResourcesMap["awsx_elasticache_replication_group"].Schema["port"].ForceNew {
+		t.Fatal("expected port to force a new resource")
+	}
+}
+
+func testReplaceReplicationGroupState(attrs map[string]string) map[string]string {
+	state := map[string]string{
+		"replication_group_id": "tf-test",
+		"description":          "test",
+		"node_type":            "cache.m5.large",
+		"num_cache_clusters":   "2",
+		"port":                 "6379",
+		"parameter.#":          "0",
+	}
+	for k, v := range attrs {
+		state[k] = v
+	}
+	return state
+}
+
+func TestReplaceReplicationGroup_refused(t *testing.T) {
+	cases := []struct {
+		attrs map[string]string
+		err   string
+	}{
+		{map[string]string{"replacement_strategy": "recreate"}, "taint it"},
+		{map[string]string{"replacement_strategy": "recreate", "deletion_protection": "true"}, "taint it"},
+		{map[string]string{"replacement_strategy": "blue_green", "deletion_protection": "true"}, "has deletion_protection enabled"},
+		{map[string]string{"replacement_strategy": "blue_green", "global_replication_group_role": "secondary"}, "is the secondary of a Global Datastore"},
+	}
+
+	for i, c := range cases {
+		var id string
+		err := testReplicationGroupUpdate(testReplaceReplicationGroupState(c.attrs), map[string]string{"port": "6380"}, func(d *schema.ResourceData) error {
+			defer func() { id = d.Id() }()
+			return replaceReplicationGroup(context.Background(), d, &AWSClient{stopCtx: context.Background()}, replicationGroupReplacingChanges(d), time.Minute)
+		})
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%d: expected error %q, got %v", i, c.err, err)
+		}
+		if !strings.Contains(err.Error(), "port") {
+			t.Fatalf("%d: expected the changed attribute in the error, got %s", i, err)
+		}
+		if id != "tf-test" {
+			t.Fatalf("%d: expected the id to stay, got %q", i, id)
+		}
+	}
+}
+
+func TestReplaceReplicationGroup_blueGreenSnapshotFailure(t *testing.T) {
+	var mu sync.Mutex
+	var actions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		mu.Lock()
+		actions = append(actions, params.Get("Action"))
+		mu.Unlock()
+
+		switch params.Get("Action") {
+		case "DescribeReplicationGroups":
+			fmt.Fprint(w, `<DescribeReplicationGroupsResponse><DescribeReplicationGroupsResult><ReplicationGroups>
+  <ReplicationGroup><ReplicationGroupId>tf-test</ReplicationGroupId><Status>available</Status></ReplicationGroup>
+</ReplicationGroups></DescribeReplicationGroupsResult></DescribeReplicationGroupsResponse>`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>SnapshotQuotaExceededFault</Code><Message>quota exceeded</Message></Error></ErrorResponse>`)
+		}
+	}))
+	defer srv.Close()
+
+	client := &AWSClient{elasticacheconn: testFakeElasticacheConn(srv.URL), stopCtx: context.Background()}
+	var id string
+	state := testReplaceReplicationGroupState(map[string]string{"replacement_strategy": "blue_green"})
+	err := testReplicationGroupUpdate(state, map[string]string{"port": "6380"}, func(d *schema.ResourceData) error {
+		defer func() { id = d.Id() }()
+		return replaceReplicationGroup(context.Background(), d, client, replicationGroupReplacingChanges(d), time.Minute)
+	})
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("expected the snapshot error, got %v", err)
+	}
+	if id != "tf-test" {
+		t.Fatalf("expected the old group to stay in use, got %q", id)
+	}
+	for _, a := range actions {
+		if a == "CreateReplicationGroup" || a == "DeleteReplicationGroup" {
+			t.Fatalf("unexpected %s after the snapshot failed: %v", a, actions)
+		}
+	}
+}
+
+func TestDiscardReplicationGroupReplacement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		switch params.Get("Action") {
+		case "DescribeReplicationGroups":
+			fmt.Fprintf(w, `<DescribeReplicationGroupsResponse><DescribeReplicationGroupsResult><ReplicationGroups>
+  <ReplicationGroup><ReplicationGroupId>%s</ReplicationGroupId><Status>available</Status></ReplicationGroup>
+</ReplicationGroups></DescribeReplicationGroupsResult></DescribeReplicationGroupsResponse>`, params.Get("ReplicationGroupId"))
+		case "DeleteReplicationGroup":
+			mu.Lock()
+			deleted = append(deleted, params.Get("ReplicationGroupId"))
+			mu.Unlock()
+			fmt.Fprintf(w, `<DeleteReplicationGroupResponse><DeleteReplicationGroupResult>
+  <ReplicationGroup><ReplicationGroupId>%s</ReplicationGroupId><Status>deleting</Status></ReplicationGroup>
+</DeleteReplicationGroupResult></DeleteReplicationGroupResponse>`, params.Get("ReplicationGroupId"))
+			// Stops the wait for the deletion
+			cancel()
+		default:
+			fmt.Fprint(w, `<DescribeEventsResponse><DescribeEventsResult><Events/></DescribeEventsResult></DescribeEventsResponse>`)
+		}
+	}))
+	defer srv.Close()
+
+	client := &AWSClient{elasticacheconn: testFakeElasticacheConn(srv.URL), stopCtx: ctx}
+	cases := []struct {
+		id      string
+		deleted []string
+		err     string
+	}{
+		// The create has failed and on_create_failure has removed the group
+		{"", nil, "the old group stays in use: boom"},
+		{"tf-test-s44we8", []string{"tf-test-s44we8"}, "the new group, it has to be deleted by hand"},
+	}
+
+	for i, c := range cases {
+		deleted = nil
+		var id string
+		err := testReplicationGroupUpdate(testReplaceReplicationGroupState(nil), map[string]string{"port": "6380"}, func(d *schema.ResourceData) error {
+			defer func() { id = d.Id() }()
+			d.SetId(c.id)
+			return discardReplicationGroupReplacement(ctx, d, client, "tf-test", "tf-test-s44we8", fmt.Errorf("boom"))
+		})
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%d: expected error %q, got %v", i, c.err, err)
+		}
+		if id != "tf-test" {
+			t.Fatalf("%d: expected the old group to be in use, got %q", i, id)
+		}
+		if fmt.Sprint(deleted) != fmt.Sprint(c.deleted) {
+			t.Fatalf("%d: expected %v to be deleted, got %v", i, c.deleted, deleted)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// transitEncryptionLevels are the settings an existing group has to go
+// through one by one: AWS only enables transit encryption in preferred
+// mode and only disables it from there.
+var transitEncryptionLevels = []string{
+	"disabled",
+	elasticache.TransitEncryptionModePreferred,
+	elasticache.TransitEncryptionModeRequired,
+}
+
+// transitEncryptionLevel maps the two attributes to one of
+// transitEncryptionLevels. An enabled group without a mode predates
+// the modes and behaves like required, while enabling without a mode
+// starts with preferred.
+func transitEncryptionLevel(enabled bool, mode string, current bool) string {
+	switch {
+	case !enabled:
+		return "disabled"
+	case mode != "":
+		return mode
+	case current:
+		return elasticache.TransitEncryptionModeRequired
+	}
+	return elasticache.TransitEncryptionModePreferred
+}
+
+// transitEncryptionSteps returns the levels to set one after another
+// to get from one level to the other, never skipping one in between.
+func transitEncryptionSteps(from, to string) []string {
+	i, j := -1, -1
+	for k, l := range transitEncryptionLevels {
+		if l == from {
+			i = k
+		}
+		if l == to {
+			j = k
+		}
+	}
+	if i < 0 || j < 0 {
+		return nil
+	}
+
+	var steps []string
+	for i != j {
+		if i < j {
+			i++
+		} else {
+			i--
+		}
+		steps = append(steps, transitEncryptionLevels[i])
+	}
+	return steps
+}
+
+// transitEncryptionStepRequest changes the transit encryption
+// of the group from one level to the adjacent one.
+func transitEncryptionStepRequest(replGroupID, from, to string) *elasticache.ModifyReplicationGroupInput {
+	req := &elasticache.ModifyReplicationGroupInput{
+		ReplicationGroupId: aws.String(replGroupID),
+		ApplyImmediately:   aws.Bool(true),
+	}
+	switch {
+	case from == "disabled":
+		req.TransitEncryptionEnabled = aws.Bool(true)
+		req.TransitEncryptionMode = aws.String(to)
+	case to == "disabled":
+		req.TransitEncryptionEnabled = aws.Bool(false)
+	default:
+		req.TransitEncryptionMode = aws.String(to)
+	}
+	return req
+}
+
+// updateReplicationGroupTransitEncryption is the update step that moves
+// the transit encryption to the adjacent level and waits for the group to
+// become available. A change that spans more levels is refused, clients
+// have to be moved over in between, so each level takes its own apply.
+func updateReplicationGroupTransitEncryption(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache) error {
+	if !d.HasChange("transit_encryption_enabled") && !d.HasChange("transit_encryption_mode") {
+		return nil
+	}
+
+	oEnabled, nEnabled := d.GetChange("transit_encryption_enabled")
+	oMode, nMode := d.GetChange("transit_encryption_mode")
+	from := transitEncryptionLevel(oEnabled.(bool), oMode.(string), true)
+	to := transitEncryptionLevel(nEnabled.(bool), nMode.(string), false)
+	if !nEnabled.(bool) && d.HasChange("transit_encryption_mode") && nMode.(string) != "" {
+		return fmt.Errorf("transit_encryption_mode %q requires transit_encryption_enabled", nMode)
+	}
+
+	steps := transitEncryptionSteps(from, to)
+	if len(steps) == 0 {
+		return nil
+	}
+	if len(steps) > 1 {
+		return fmt.Errorf("ElastiCache Replication Group (%s) can't change transit encryption from %s to %s in one apply, "+
+			"change it to %s and apply that first", d.Id(), from, to, steps[0])
+	}
+
+	log.Printf("[INFO] Changing transit encryption of ElastiCache Replication Group (%s) from %s to %s", d.Id(), from, to)
+	req := transitEncryptionStepRequest(d.Id(), from, to)
+	if err := modifyReplicationGroupAndWait(ctx, conn, req, "", d.Timeout(schema.TimeoutUpdate)); err != nil {
+		return fmt.Errorf("Error changing transit encryption of elasticache (%s) from %s to %s: %s", d.Id(), from, to, err)
+	}
+
+	d.SetPartial("transit_encryption_enabled")
+	d.SetPartial("transit_encryption_mode")
+	return nil
+}
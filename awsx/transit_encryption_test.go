@@ -0,0 +1,96 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestTransitEncryptionSteps(t *testing.T) {
+	cases := []struct {
+		From, To string
+		Steps    string
+	}{
+		{"disabled", "preferred", "[preferred]"},
+		{"disabled", "required", "[preferred required]"},
+		{"preferred", "required", "[required]"},
+		{"required", "disabled", "[preferred disabled]"},
+		{"required", "required", "[]"},
+	}
+
+	for _, tc := range cases {
+		if steps := fmt.Sprint(transitEncryptionSteps(tc.From, tc.To)); steps != tc.Steps {
+			t.Fatalf("%s -> %s: expected %s, got %s", tc.From, tc.To, tc.Steps, steps)
+		}
+	}
+}
+
+func TestTransitEncryptionLevel(t *testing.T) {
+	cases := []struct {
+		Enabled  bool
+		Mode     string
+		Current  bool
+		Expected string
+	}{
+		{false, "", true, "disabled"},
+		{false, "preferred", false, "disabled"},
+		{true, "required", false, "required"},
+		{true, "", true, "required"},
+		{true, "", false, "preferred"},
+	}
+
+	for _, tc := range cases {
+		if level := transitEncryptionLevel(tc.Enabled, tc.Mode, tc.Current); level != tc.Expected {
+			t.Fatalf("%#v: got %s", tc, level)
+		}
+	}
+}
+
+func TestTransitEncryptionStepRequest(t *testing.T) {
+	req := transitEncryptionStepRequest("tf-test", "disabled", "preferred")
+	if !aws.BoolValue(req.TransitEncryptionEnabled) || aws.StringValue(req.TransitEncryptionMode) != "preferred" {
+		t.Fatalf("expected enabling in preferred mode, got %s", req)
+	}
+
+	req = transitEncryptionStepRequest("tf-test", "preferred", "required")
+	if req.TransitEncryptionEnabled != nil || aws.StringValue(req.TransitEncryptionMode) != "required" {
+		t.Fatalf("expected only the mode to change, got %s", req)
+	}
+
+	req = transitEncryptionStepRequest("tf-test", "preferred", "disabled")
+	if req.TransitEncryptionEnabled == nil || *req.TransitEncryptionEnabled || req.TransitEncryptionMode != nil {
+		t.Fatalf("expected disabling, got %s", req)
+	}
+}
+
+func TestUpdateReplicationGroupTransitEncryption_oneLevel(t *testing.T) {
+	cases := []struct {
+		state, changed map[string]string
+		err            string
+	}{
+		{
+			map[string]string{"transit_encryption_enabled": "false"},
+			map[string]string{"transit_encryption_enabled": "true", "transit_encryption_mode": "required"},
+			"from disabled to required in one apply, change it to preferred",
+		},
+		{
+			map[string]string{"transit_encryption_enabled": "true", "transit_encryption_mode": "required"},
+			map[string]string{"transit_encryption_enabled": "false", "transit_encryption_mode": ""},
+			"from required to disabled in one apply, change it to preferred",
+		},
+	}
+
+	for i, c := range cases {
+		c.state["replication_group_id"] = "tf-test"
+		err := testReplicationGroupUpdate(c.state, c.changed, func(d *schema.ResourceData) error {
+			return updateReplicationGroupTransitEncryption(context.Background(), d, nil)
+		})
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%d: expected error %q, got %v", i, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// majorVersionUpgradeFamily returns the parameter group family of the
+// target version if moving between the versions changes the family,
+// i.e. is a major upgrade, and "" otherwise.
+func majorVersionUpgradeFamily(engine, from, to string) (string, error) {
+	if from == "" || to == "" {
+		return "", nil
+	}
+	toFamily, err := engineParameterGroupFamily(engine, to)
+	if err != nil {
+		return "", err
+	}
+	fromFamily, err := engineParameterGroupFamily(engine, from)
+	if err != nil || fromFamily == toFamily {
+		return "", nil
+	}
+	return toFamily, nil
+}
+
+// isOrchestratedMajorUpgrade tells whether the engine_version change is
+// a major upgrade that has to go through upgradeReplicationGroupEngine
+// rather than being a part of the regular modification.
+func isOrchestratedMajorUpgrade(d *schema.ResourceData) bool {
+	if !d.Get("orchestrate_major_version_upgrade").(bool) || d.HasChange("engine") || !d.HasChange("engine_version") {
+		return false
+	}
+	o, n := d.GetChange("engine_version")
+	family, err := majorVersionUpgradeFamily(d.Get("engine").(string), o.(string), n.(string))
+	return err == nil && family != ""
+}
+
+// preUpgradeSnapshotName makes a snapshot name that is unique
+// and sticks to the letters, digits and single hyphens allowed.
+func preUpgradeSnapshotName(replGroupID, family string, now time.Time) string {
+	return fmt.Sprintf("%s-pre-%s-%d", replGroupID, strings.Replace(family, ".", "-", -1), now.Unix())
+}
+
+// updateReplicationGroupEngineVersion is the update step that carries out
+// a major engine upgrade: it takes a manual snapshot first, switches a
+// default parameter group to the default one of the new family, applies
+// the new version and verifies that every member runs it, all of it
+// within the timeout.
+func updateReplicationGroupEngineVersion(ctx context.Context, d *schema.ResourceData, conn *elasticache.ElastiCache, timeout time.Duration) error {
+	if !isOrchestratedMajorUpgrade(d) {
+		return nil
+	}
+
+	engine := d.Get("engine").(string)
+	o, n := d.GetChange("engine_version")
+	version := n.(string)
+	family, err := majorVersionUpgradeFamily(engine, o.(string), version)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+
+	parameterGroupName, changed, err := replicationGroupParameterGroup(d)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		if strings.HasPrefix(parameterGroupName, "default.") {
+			parameterGroupName = "default." + family
+			log.Printf("[DEBUG] Switching ElastiCache Replication Group (%s) to the parameter group (%s)", d.Id(), parameterGroupName)
+		} else {
+			return fmt.Errorf("ElastiCache Replication Group (%s) uses a custom parameter group (%s), "+
+				"set parameter_group_name to one of the %s family for the upgrade to %s", d.Id(), parameterGroupName, family, version)
+		}
+	}
+	if err := validateEngineConfiguration(ctx, conn, engine, version, parameterGroupName); err != nil {
+		return err
+	}
+
+	if err := waitForReplicationGroupOperationInProgress(ctx, conn, d.Id(), time.Until(deadline)); err != nil {
+		return err
+	}
+
+	snapshotName := preUpgradeSnapshotName(d.Id(), family, time.Now())
+	log.Printf("[INFO] Taking snapshot (%s) of ElastiCache Replication Group (%s) before upgrading to %s", snapshotName, d.Id(), version)
+	if err := snapshotReplicationGroup(ctx, conn, d.Id(), snapshotName, time.Until(deadline)); err != nil {
+		return err
+	}
+
+	req := &elasticache.ModifyReplicationGroupInput{
+		ReplicationGroupId:      aws.String(d.Id()),
+		EngineVersion:           aws.String(version),
+		CacheParameterGroupName: aws.String(parameterGroupName),
+		ApplyImmediately:        aws.Bool(true),
+	}
+	if err := modifyReplicationGroupAndWait(ctx, conn, req, "", time.Until(deadline)); err != nil {
+		return err
+	}
+
+	if err := verifyReplicationGroupEngineVersion(ctx, conn, d.Id(), engine, family, parameterGroupName); err != nil {
+		return fmt.Errorf("%s (the pre-upgrade snapshot is %s)", err, snapshotName)
+	}
+
+	d.Set("parameter_group_name", parameterGroupName)
+	d.SetPartial("engine_version")
+	d.SetPartial("parameter_group_name")
+	return nil
+}
+
+// snapshotReplicationGroup takes a manual snapshot of the group
+// and waits for it to become available.
+func snapshotReplicationGroup(ctx context.Context, conn *elasticache.ElastiCache, replGroupID, snapshotName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	err := retryWhileReplicationGroupBusy(ctx, conn, replGroupID, deadline, func() error {
+		_, err := conn.CreateSnapshotWithContext(ctx, &elasticache.CreateSnapshotInput{
+			ReplicationGroupId: aws.String(replGroupID),
+			SnapshotName:       aws.String(snapshotName),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Error taking snapshot (%s) of elasticache (%s): %s", snapshotName, replGroupID, err)
+	}
+
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{"creating"},
+		Target:     []string{"available"},
+		Refresh:    snapshotStateRefreshFunc(ctx, conn, snapshotName),
+		Timeout:    time.Until(deadline),
+		Delay:      10 * time.Second,
+		MinTimeout: 5 * time.Second,
+	}
+	if _, err := waitForState(ctx, stateConf, "the snapshot"); err != nil {
+		return fmt.Errorf("Error waiting for snapshot (%s) of elasticache (%s): %s", snapshotName, replGroupID, err)
+	}
+	return nil
+}
+
+// verifyReplicationGroupEngineVersion checks that every member
+// runs a version of the family and uses the parameter group.
+func verifyReplicationGroupEngineVersion(ctx context.Context, conn *elasticache.ElastiCache, replGroupID, engine, family, parameterGroupName string) error {
+	rg, err := describeReplicationGroup(ctx, conn, replGroupID)
+	if err != nil {
+		return err
+	}
+	if rg == nil {
+		return fmt.Errorf("ElastiCache Replication Group (%s) not found after the upgrade", replGroupID)
+	}
+
+	ids := aws.StringValueSlice(rg.MemberClusters)
+	clusters, err := describeMemberClusters(ctx, conn, ids, memberClusterDescribeConcurrency)
+	if err != nil {
+		return err
+	}
+
+	var mismatches []string
+	for _, id := range ids {
+		c := clusters[id]
+		if c == nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s can't be described", id))
+			continue
+		}
+		version := aws.StringValue(c.EngineVersion)
+		if f, _ := engineParameterGroupFamily(engine, version); f != family {
+			mismatches = append(mismatches, fmt.Sprintf("%s runs %s", id, version))
+		}
+		if c.CacheParameterGroup != nil && aws.StringValue(c.CacheParameterGroup.CacheParameterGroupName) != parameterGroupName {
+			mismatches = append(mismatches, fmt.Sprintf("%s uses %s", id, aws.StringValue(c.CacheParameterGroup.CacheParameterGroupName)))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("ElastiCache Replication Group (%s) hasn't been upgraded to %s with %s: %s",
+			replGroupID, family, parameterGroupName, strings.Join(mismatches, ", "))
+	}
+	return nil
+}
+
+func snapshotStateRefreshFunc(ctx context.Context, conn *elasticache.ElastiCache, snapshotName string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		res, err := conn.DescribeSnapshotsWithContext(ctx, &elasticache.DescribeSnapshotsInput{
+			SnapshotName: aws.String(snapshotName),
+		})
+		if err != nil {
+			if isAWSErr(err, "SnapshotNotFoundFault", "") {
+				return nil, "", nil
+			}
+			return nil, "", err
+		}
+		if len(res.Snapshots) == 0 {
+			return nil, "", nil
+		}
+
+		s := res.Snapshots[0]
+		log.Printf("[DEBUG] ElastiCache Snapshot (%s) status: %s", snapshotName, aws.StringValue(s.SnapshotStatus))
+		return s, aws.StringValue(s.SnapshotStatus), nil
+	}
+}
@@ -0,0 +1,125 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestMajorVersionUpgradeFamily(t *testing.T) {
+	cases := []struct {
+		Engine, From, To, Family string
+		ErrCount                 int
+	}{
+		{"redis", "6.2", "7.1", "redis7", 0},
+		{"redis", "5.0.6", "6.x", "redis6.x", 0},
+		{"redis", "6.0", "6.2", "", 0},
+		{"redis", "7.0", "7.1", "", 0},
+		{"redis", "", "7.1", "", 0},
+		{"valkey", "7.2", "8.0", "valkey8", 0},
+		{"redis", "7.1", "8.0", "", 1},
+	}
+
+	for _, tc := range cases {
+		family, err := majorVersionUpgradeFamily(tc.Engine, tc.From, tc.To)
+		if (err != nil) != (tc.ErrCount > 0) {
+			t.Fatalf("%s %s -> %s: unexpected error: %v", tc.Engine, tc.From, tc.To, err)
+		}
+		if family != tc.Family {
+			t.Fatalf("%s %s -> %s: expected %q, got %q", tc.Engine, tc.From, tc.To, tc.Family, family)
+		}
+	}
+}
+
+func TestPreUpgradeSnapshotName(t *testing.T) {
+	name := preUpgradeSnapshotName("tf-test", "redis6.x", time.Unix(1500000000, 0))
+	if name != "tf-test-pre-redis6-x-1500000000" {
+		t.Fatalf("unexpected snapshot name: %s", name)
+	}
+}
+
+func TestUpdateReplicationGroupEngineVersion_parameterGroup(t *testing.T) {
+	cases := []struct {
+		parameterGroupName string
+		err                string
+	}{
+		// Switched, and looked up before anything is changed
+		{"default.redis6.x", "Parameter group (default.redis7) not found"},
+		{"tf-test-redis6", "uses a custom parameter group (tf-test-redis6)"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<DescribeCacheParameterGroupsResponse><DescribeCacheParameterGroupsResult><CacheParameterGroups/></DescribeCacheParameterGroupsResult></DescribeCacheParameterGroupsResponse>`)
+	}))
+	defer srv.Close()
+	conn := testFakeElasticacheConn(srv.URL)
+
+	for i, c := range cases {
+		state := map[string]string{
+			"replication_group_id":              "tf-test",
+			"engine":                            "redis",
+			"engine_version":                    "6.2",
+			"parameter_group_name":              c.parameterGroupName,
+			"orchestrate_major_version_upgrade": "true",
+			"parameter.#":                       "0",
+		}
+		err := testReplicationGroupUpdate(state, map[string]string{"engine_version": "7.1"}, func(d *schema.ResourceData) error {
+			return updateReplicationGroupEngineVersion(context.Background(), d, conn, time.Minute)
+		})
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%d: expected error %q, got %v", i, c.err, err)
+		}
+	}
+}
+
+func TestVerifyReplicationGroupEngineVersion(t *testing.T) {
+	clusters := map[string]string{
+		"tf-test-001": "7.1.0",
+		"tf-test-002": "6.2.6",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		switch params.Get("Action") {
+		case "DescribeReplicationGroups":
+			fmt.Fprint(w, `<DescribeReplicationGroupsResponse><DescribeReplicationGroupsResult><ReplicationGroups>
+  <ReplicationGroup><ReplicationGroupId>tf-test</ReplicationGroupId><Status>available</Status>
+    <MemberClusters><ClusterId>tf-test-001</ClusterId><ClusterId>tf-test-002</ClusterId><ClusterId>tf-test-003</ClusterId></MemberClusters>
+  </ReplicationGroup>
+</ReplicationGroups></DescribeReplicationGroupsResult></DescribeReplicationGroupsResponse>`)
+		case "DescribeCacheClusters":
+			id := params.Get("CacheClusterId")
+			version, ok := clusters[id]
+			if !ok {
+				fmt.Fprint(w, `<DescribeCacheClustersResponse><DescribeCacheClustersResult><CacheClusters/></DescribeCacheClustersResult></DescribeCacheClustersResponse>`)
+				return
+			}
+			fmt.Fprintf(w, `<DescribeCacheClustersResponse><DescribeCacheClustersResult><CacheClusters>
+  <CacheCluster><CacheClusterId>%s</CacheClusterId><EngineVersion>%s</EngineVersion>
+    <CacheParameterGroup><CacheParameterGroupName>default.redis7</CacheParameterGroupName></CacheParameterGroup>
+  </CacheCluster>
+</CacheClusters></DescribeCacheClustersResult></DescribeCacheClustersResponse>`, id, version)
+		}
+	}))
+	defer srv.Close()
+
+	err := verifyReplicationGroupEngineVersion(context.Background(), testFakeElasticacheConn(srv.URL), "tf-test", "redis", "redis7", "default.redis7")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, s := range []string{"tf-test-002 runs 6.2.6", "tf-test-003 can't be described"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("expected %q in the error, got %s", s, err)
+		}
+	}
+	if strings.Contains(err.Error(), "tf-test-001") {
+		t.Fatalf("unexpected mismatch of the upgraded member: %s", err)
+	}
+}
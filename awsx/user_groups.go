@@ -0,0 +1,110 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// setUserGroupChanges sets the user group changes from o to n on req and
+// returns the attached and the detached user groups. Detaching the last
+// ones takes RemoveUserGroups alone, ElastiCache rejects it along with
+// UserGroupIdsToRemove.
+func setUserGroupChanges(req *elasticache.ModifyReplicationGroupInput, o, n *schema.Set) ([]string, []string) {
+	var attached, detached []string
+	if add := n.Difference(o); add.Len() > 0 {
+		req.UserGroupIdsToAdd = expandStringList(add.List())
+		attached = aws.StringValueSlice(req.UserGroupIdsToAdd)
+	}
+	if remove := o.Difference(n); remove.Len() > 0 {
+		if n.Len() == 0 {
+			req.RemoveUserGroups = aws.Bool(true)
+		} else {
+			req.UserGroupIdsToRemove = expandStringList(remove.List())
+		}
+		detached = aws.StringValueSlice(expandStringList(remove.List()))
+	}
+	return attached, detached
+}
+
+// waitForUserGroupAssociations waits until the attached user groups are
+// active and list the replication group, and the detached ones no longer
+// list it. Either of the lists may be empty.
+func waitForUserGroupAssociations(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string, attached, detached []string, timeout time.Duration) error {
+	if len(attached) == 0 && len(detached) == 0 {
+		return nil
+	}
+
+	log.Printf("[DEBUG] Waiting for user group associations of (%s): attached %v, detached %v", replGroupID, attached, detached)
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{"modifying"},
+		Target:     []string{"active"},
+		Refresh:    userGroupAssociationsRefreshFunc(ctx, conn, replGroupID, attached, detached),
+		Timeout:    timeout,
+		Delay:      5 * time.Second,
+		MinTimeout: 3 * time.Second,
+	}
+
+	if _, err := waitForState(ctx, stateConf, "the user groups"); err != nil {
+		return fmt.Errorf("Error waiting for user groups of elasticache (%s) to become active: %s", replGroupID, err)
+	}
+	return nil
+}
+
+func userGroupAssociationsRefreshFunc(ctx context.Context, conn *elasticache.ElastiCache, replGroupID string, attached, detached []string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		for _, id := range attached {
+			ug, err := describeUserGroup(ctx, conn, id)
+			if err != nil {
+				return nil, "", err
+			}
+			if ug == nil {
+				return nil, "", fmt.Errorf("user group (%s) not found", id)
+			}
+			if aws.StringValue(ug.Status) != "active" || !stringInSlice(replGroupID, aws.StringValueSlice(ug.ReplicationGroups)) {
+				log.Printf("[DEBUG] User group (%s) is not yet associated with (%s), status: %s", id, replGroupID, aws.StringValue(ug.Status))
+				return replGroupID, "modifying", nil
+			}
+		}
+
+		for _, id := range detached {
+			ug, err := describeUserGroup(ctx, conn, id)
+			if err != nil {
+				return nil, "", err
+			}
+			if ug != nil && stringInSlice(replGroupID, aws.StringValueSlice(ug.ReplicationGroups)) {
+				log.Printf("[DEBUG] User group (%s) is still associated with (%s), status: %s", id, replGroupID, aws.StringValue(ug.Status))
+				return replGroupID, "modifying", nil
+			}
+		}
+
+		return replGroupID, "active", nil
+	}
+}
+
+// describeUserGroup returns nil if the user group doesn't exist.
+func describeUserGroup(ctx context.Context, conn *elasticache.ElastiCache, userGroupID string) (*elasticache.UserGroup, error) {
+	res, err := conn.DescribeUserGroupsWithContext(ctx, &elasticache.DescribeUserGroupsInput{
+		UserGroupId: aws.String(userGroupID),
+	})
+	if err != nil {
+		if isAWSErr(err, "UserGroupNotFound", "") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, ug := range res.UserGroups {
+		if aws.StringValue(ug.UserGroupId) == userGroupID {
+			return ug, nil
+		}
+	}
+	return nil, nil
+}
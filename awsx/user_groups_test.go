@@ -0,0 +1,139 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestSetUserGroupChanges(t *testing.T) {
+	cases := []struct {
+		o, n               []interface{}
+		attached, detached []string
+		toAdd, toRemove    []string
+		removeAll          bool
+	}{
+		{
+			o: []interface{}{}, n: []interface{}{"ug-1"},
+			attached: []string{"ug-1"},
+			toAdd:    []string{"ug-1"},
+		},
+		{
+			o: []interface{}{"ug-1"}, n: []interface{}{"ug-2"},
+			attached: []string{"ug-2"}, detached: []string{"ug-1"},
+			toAdd: []string{"ug-2"}, toRemove: []string{"ug-1"},
+		},
+		{
+			o: []interface{}{"ug-1", "ug-2"}, n: []interface{}{"ug-2"},
+			detached: []string{"ug-1"},
+			toRemove: []string{"ug-1"},
+		},
+		{
+			o: []interface{}{"ug-1", "ug-2"}, n: []interface{}{},
+			detached:  []string{"ug-1", "ug-2"},
+			removeAll: true,
+		},
+	}
+
+	for i, c := range cases {
+		req := &elasticache.ModifyReplicationGroupInput{}
+		attached, detached := setUserGroupChanges(req,
+			schema.NewSet(schema.HashString, c.o), schema.NewSet(schema.HashString, c.n))
+
+		sort.Strings(detached)
+		if !reflect.DeepEqual(attached, c.attached) || !reflect.DeepEqual(detached, c.detached) {
+			t.Fatalf("%d: expected attached %v detached %v, got %v %v", i, c.attached, c.detached, attached, detached)
+		}
+		toAdd := aws.StringValueSlice(req.UserGroupIdsToAdd)
+		if len(toAdd) == 0 {
+			toAdd = nil
+		}
+		toRemove := aws.StringValueSlice(req.UserGroupIdsToRemove)
+		if len(toRemove) == 0 {
+			toRemove = nil
+		}
+		if !reflect.DeepEqual(toAdd, c.toAdd) || !reflect.DeepEqual(toRemove, c.toRemove) {
+			t.Fatalf("%d: expected to add %v remove %v, got %v %v", i, c.toAdd, c.toRemove, toAdd, toRemove)
+		}
+		if aws.BoolValue(req.RemoveUserGroups) != c.removeAll {
+			t.Fatalf("%d: expected RemoveUserGroups %t, got %v", i, c.removeAll, req.RemoveUserGroups)
+		}
+		if req.RemoveUserGroups != nil && req.UserGroupIdsToRemove != nil {
+			t.Fatalf("%d: RemoveUserGroups is sent along with UserGroupIdsToRemove", i)
+		}
+	}
+}
+
+// testFakeDescribeUserGroups serves DescribeUserGroups from the given
+// status and replication groups of each user group, the ones not listed
+// don't exist.
+func testFakeDescribeUserGroups(groups map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		id := params.Get("UserGroupId")
+		g, ok := groups[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>UserGroupNotFound</Code><Message>not found</Message></Error></ErrorResponse>`)
+			return
+		}
+		var rgs string
+		for _, rg := range g[1:] {
+			rgs += "<member>" + rg + "</member>"
+		}
+		fmt.Fprintf(w, `<DescribeUserGroupsResponse><DescribeUserGroupsResult><UserGroups>
+  <member><UserGroupId>%s</UserGroupId><Status>%s</Status><ReplicationGroups>%s</ReplicationGroups></member>
+</UserGroups></DescribeUserGroupsResult></DescribeUserGroupsResponse>`, id, g[0], rgs)
+	}))
+}
+
+func TestUserGroupAssociationsRefreshFunc(t *testing.T) {
+	srv := testFakeDescribeUserGroups(map[string][]string{
+		"ug-active":    {"active", "tf-test"},
+		"ug-modifying": {"modifying", "tf-test"},
+		"ug-pending":   {"active"},
+		"ug-other":     {"active", "tf-other"},
+	})
+	defer srv.Close()
+	conn := testFakeElasticacheConn(srv.URL)
+
+	cases := []struct {
+		attached, detached []string
+		state              string
+		err                string
+	}{
+		{attached: []string{"ug-active"}, detached: []string{"ug-other", "ug-gone"}, state: "active"},
+		{attached: []string{"ug-active", "ug-modifying"}, state: "modifying"},
+		{attached: []string{"ug-pending"}, state: "modifying"},
+		{detached: []string{"ug-active"}, state: "modifying"},
+		{attached: []string{"ug-gone"}, err: "user group (ug-gone) not found"},
+	}
+
+	for i, c := range cases {
+		_, state, err := userGroupAssociationsRefreshFunc(context.Background(), conn, "tf-test", c.attached, c.detached)()
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("%d: expected error %q, got %v", i, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if state != c.state {
+			t.Fatalf("%d: expected %s, got %s", i, c.state, state)
+		}
+	}
+}
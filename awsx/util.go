@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 )
 
 func validateElastiCacheReplictionGroupId(v interface{}, k string) (ws []string, errors []error) {
@@ -44,6 +45,34 @@ func expandStringList(configured []interface{}) []*string {
 	return vs
 }
 
+// Takes a list of string pointers from the AWS API
+// and returns a []interface{} suitable for schema.Set
+func flattenStringList(list []*string) []interface{} {
+	vs := make([]interface{}, 0, len(list))
+	for _, v := range list {
+		vs = append(vs, *v)
+	}
+	return vs
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isAWSErr returns true if err is an awserr.Error with the given code
+// and a message containing the given string.
+func isAWSErr(err error, code string, message string) bool {
+	if err, ok := err.(awserr.Error); ok {
+		return err.Code() == code && strings.Contains(err.Message(), message)
+	}
+	return false
+}
+
 type awsLogger struct{}
 
 func (l awsLogger) Log(args ...interface{}) {
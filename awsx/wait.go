@@ -0,0 +1,106 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+// interruptedError is returned by the waits that are cut short
+// by the provider being stopped, e.g. on Ctrl-C.
+type interruptedError struct {
+	what  string
+	state string
+}
+
+func (e *interruptedError) Error() string {
+	if e.state == "" {
+		return fmt.Sprintf("interrupted, the state of %s is unknown", e.what)
+	}
+	return fmt.Sprintf("interrupted, %s is still in state %q", e.what, e.state)
+}
+
+// waitForState is conf.WaitForState that returns as soon as ctx is done
+// instead of polling until the timeout. what names the awaited thing
+// in the error, e.g. "the replication group".
+func waitForState(ctx context.Context, conf *resource.StateChangeConf, what string) (interface{}, error) {
+	var mu sync.Mutex
+	var lastState string
+	refresh := conf.Refresh
+	conf.Refresh = func() (interface{}, string, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		result, state, err := refresh()
+		if err == nil {
+			mu.Lock()
+			lastState = state
+			mu.Unlock()
+		}
+		return result, state, err
+	}
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := conf.WaitForState()
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		mu.Lock()
+		defer mu.Unlock()
+		return nil, &interruptedError{what: what, state: lastState}
+	}
+}
+
+// retry is resource.Retry that returns as soon as ctx is done.
+func retry(ctx context.Context, timeout time.Duration, f resource.RetryFunc) error {
+	var mu sync.Mutex
+	var lastErr error
+	conf := &resource.StateChangeConf{
+		Pending:    []string{"retryableerror"},
+		Target:     []string{"success"},
+		Timeout:    timeout,
+		MinTimeout: 500 * time.Millisecond,
+		Refresh: func() (interface{}, string, error) {
+			rerr := f()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if rerr == nil {
+				lastErr = nil
+				return 42, "success", nil
+			}
+			lastErr = rerr.Err
+			if rerr.Retryable {
+				return 42, "retryableerror", nil
+			}
+			return nil, "quit", rerr.Err
+		},
+	}
+
+	_, err := waitForState(ctx, conf, "")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := err.(*interruptedError); ok {
+		if lastErr != nil {
+			return fmt.Errorf("interrupted: %s", lastErr)
+		}
+		return fmt.Errorf("interrupted")
+	}
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
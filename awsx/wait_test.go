@@ -0,0 +1,67 @@
+package awsx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestWaitForState_interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conf := &resource.StateChangeConf{
+		Pending: []string{"modifying"},
+		Target:  []string{"available"},
+		Refresh: func() (interface{}, string, error) {
+			cancel()
+			return 42, "modifying", nil
+		},
+		Timeout:    time.Minute,
+		MinTimeout: 10 * time.Second,
+	}
+
+	start := time.Now()
+	_, err := waitForState(ctx, conf, "the replication group")
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("expected the wait to end promptly, it took %s", time.Since(start))
+	}
+	if err == nil || err.Error() != `interrupted, the replication group is still in state "modifying"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWaitForState(t *testing.T) {
+	states := []string{"modifying", "available"}
+	conf := &resource.StateChangeConf{
+		Pending: []string{"modifying"},
+		Target:  []string{"available"},
+		Refresh: func() (interface{}, string, error) {
+			state := states[0]
+			states = states[1:]
+			return 42, state, nil
+		},
+		Timeout:    time.Minute,
+		MinTimeout: 10 * time.Millisecond,
+	}
+
+	if _, err := waitForState(context.Background(), conf, "the replication group"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRetry_interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	err := retry(ctx, time.Minute, func() *resource.RetryError {
+		cancel()
+		return resource.RetryableError(fmt.Errorf("node_type hasn't converged"))
+	})
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("expected the retry to end promptly, it took %s", time.Since(start))
+	}
+	if err == nil || err.Error() != "interrupted: node_type hasn't converged" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}